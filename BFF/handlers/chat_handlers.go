@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"bff/models"
+	"bff/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+
+type ChatHandlers struct {
+	messageService     *services.MessageService
+	keywordService     *services.KeywordService
+	promptService      *services.PromptService
+	modelPolicyService *services.ModelPolicyService
+	generationService  *services.GenerationService
+	streamConfig       StreamConfig
+}
+
+
+func NewChatHandlers(messageService *services.MessageService, keywordService *services.KeywordService, promptService *services.PromptService, modelPolicyService *services.ModelPolicyService, generationService *services.GenerationService, streamConfig StreamConfig) *ChatHandlers {
+	return &ChatHandlers{
+		messageService:     messageService,
+		keywordService:     keywordService,
+		promptService:      promptService,
+		modelPolicyService: modelPolicyService,
+		generationService:  generationService,
+		streamConfig:       streamConfig,
+	}
+}
+
+
+// PostChatStream stores a message and streams its answer in one call,
+// keeping the user ID out of the URL. The answer comes as NDJSON, or as
+// JSON SSE events when the client accepts text/event-stream.
+func (h *ChatHandlers) PostChatStream(c *gin.Context) {
+	var newMessage models.UserMessageDTO
+
+	if err := c.BindJSON(&newMessage); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	message, moderation, status, err := saveUserMessage(newMessage, h.messageService, h.keywordService, h.promptService, h.modelPolicyService)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch moderation.Verdict {
+	case models.VerdictBlocked:
+		c.JSON(http.StatusBadRequest, flaggedMessageResponse(message, moderation))
+		return
+	case models.VerdictHeld:
+		c.JSON(http.StatusAccepted, heldMessageResponse(message, moderation))
+		return
+	}
+
+	request, status, err := newGenerationRequest(&message, h.messageService, h.promptService, h.modelPolicyService)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+
+	var writer streamWriter = ndjsonStreamWriter{}
+	if strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		writer = jsonStreamWriter{}
+	}
+
+	// Follow-up messages need the conversation, which the events don't carry
+	c.Header("X-Message-Id", message.MessageId)
+	c.Header("X-Conversation-Id", message.ConversationId)
+	c.Header("X-Moderation-Verdict", moderation.Verdict)
+
+	gen := h.generationService.Start(message.UserId, message.MessageId, request)
+	streamGeneration(c, h.generationService, gen, writer, 0, h.streamConfig)
+}
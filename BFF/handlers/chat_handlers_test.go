@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bff/models"
+	"bff/services"
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newChatRouter(t *testing.T) (*gin.Engine, messageServices) {
+	gin.SetMode(gin.TestMode)
+	s := newMessageServices(t)
+	generationService := services.NewGenerationService(s.messages, services.NewFakeProvider(""), services.GenerationConfig{})
+	h := NewChatHandlers(s.messages, s.keywords, s.prompts, s.modelPolicy, generationService, StreamConfig{})
+
+	router := gin.New()
+	router.POST("/chat/stream", h.PostChatStream)
+	return router, s
+}
+
+func postChat(router *gin.Engine, body string, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/chat/stream", strings.NewReader(body))
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestPostChatStream(t *testing.T) {
+	t.Run("should store the message and stream its answer as NDJSON", func(t *testing.T) {
+		router, s := newChatRouter(t)
+
+		w := postChat(router, `{"message":"Hi there","userId":"u1"}`, "")
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+		assert.NotEmpty(t, w.Header().Get("X-Generation-Id"))
+		assert.Equal(t, models.VerdictApproved, w.Header().Get("X-Moderation-Verdict"))
+
+		messages := s.messages.GetAllMessages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, messages[0].MessageId, w.Header().Get("X-Message-Id"))
+		assert.Equal(t, messages[0].ConversationId, w.Header().Get("X-Conversation-Id"))
+
+		var events []string
+		content := ""
+		scanner := bufio.NewScanner(w.Body)
+		for scanner.Scan() {
+			var envelope struct {
+				Event string             `json:"event"`
+				Data  models.StreamDelta `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &envelope), scanner.Text())
+			events = append(events, envelope.Event)
+			if envelope.Event == models.StreamEventDelta {
+				content += envelope.Data.Content
+			}
+		}
+		assert.Equal(t, models.StreamEventMeta, events[0])
+		assert.Equal(t, models.StreamEventDone, events[len(events)-1])
+		assert.Equal(t, "You said: Hi there", content)
+	})
+
+	t.Run("should stream SSE events when the client accepts them", func(t *testing.T) {
+		router, _ := newChatRouter(t)
+
+		w := postChat(router, `{"message":"Hi there","userId":"u1"}`, "text/event-stream")
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "event: delta\ndata: {")
+		assert.Contains(t, w.Body.String(), "event: done\n")
+	})
+
+	t.Run("should reject a blocked message before streaming", func(t *testing.T) {
+		router, s := newChatRouter(t)
+		s.keywords.AddWords([]string{"spam"})
+
+		w := postChat(router, `{"message":"Buy spam","userId":"u1"}`, "")
+
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Empty(t, w.Header().Get("X-Generation-Id"))
+
+		var response map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "Message contains forbidden keywords", response["error"])
+		assert.Equal(t, []any{"spam"}, response["foundKeywords"])
+
+		messages := s.messages.GetAllMessages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, messages[0].MessageId, response["messageId"])
+		assert.True(t, messages[0].Flagged)
+	})
+
+	t.Run("should replay flagged and redacted turns as the model saw them", func(t *testing.T) {
+		router, s := newChatRouter(t)
+		require.NoError(t, s.keywords.AddRules([]string{"secret"}, models.KeywordRule{Action: models.KeywordActionRedact}))
+		require.NoError(t, s.keywords.AddRules([]string{"acme"}, models.KeywordRule{Action: models.KeywordActionFlag}))
+
+		first := postChat(router, `{"message":"My secret is 1234","userId":"u1"}`, "")
+		require.Equal(t, http.StatusOK, first.Code)
+		assert.Equal(t, models.VerdictRedacted, first.Header().Get("X-Moderation-Verdict"))
+		conversationId := first.Header().Get("X-Conversation-Id")
+
+		second := postChat(router, `{"message":"Acme is fine","userId":"u1","conversationId":"`+conversationId+`"}`, "")
+		require.Equal(t, http.StatusOK, second.Code)
+		assert.Equal(t, models.VerdictFlagged, second.Header().Get("X-Moderation-Verdict"))
+
+		third := postChat(router, `{"message":"Repeat that","userId":"u1","conversationId":"`+conversationId+`"}`, "")
+		require.Equal(t, http.StatusOK, third.Code)
+
+		current, exists := s.messages.GetMessageById(third.Header().Get("X-Message-Id"))
+		require.True(t, exists)
+		assert.Equal(t, []models.Message{
+			{Role: "user", Content: "My [REDACTED] is 1234"},
+			{Role: "assistant", Content: "You said: My [REDACTED] is 1234"},
+			{Role: "user", Content: "Acme is fine"},
+			{Role: "assistant", Content: "You said: Acme is fine"},
+			{Role: "user", Content: "Repeat that"},
+		}, s.messages.BuildChatMessages(*current))
+	})
+
+	t.Run("should reject invalid messages", func(t *testing.T) {
+		router, s := newChatRouter(t)
+
+		assert.Equal(t, http.StatusBadRequest, postChat(router, `{"message":`, "").Code)
+		assert.Equal(t, http.StatusBadRequest, postChat(router, `{"message":"Hi"}`, "").Code)
+		assert.Empty(t, s.messages.GetAllMessages())
+	})
+}
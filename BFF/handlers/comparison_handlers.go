@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bff/services"
+	"bff/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+
+type ComparisonHandlers struct {
+	messageService     *services.MessageService
+	promptService      *services.PromptService
+	modelPolicyService *services.ModelPolicyService
+	comparisonService  *services.ComparisonService
+	streamConfig       StreamConfig
+}
+
+
+func NewComparisonHandlers(messageService *services.MessageService, promptService *services.PromptService, modelPolicyService *services.ModelPolicyService, comparisonService *services.ComparisonService, streamConfig StreamConfig) *ComparisonHandlers {
+	return &ComparisonHandlers{
+		messageService:     messageService,
+		promptService:      promptService,
+		modelPolicyService: modelPolicyService,
+		comparisonService:  comparisonService,
+		streamConfig:       streamConfig,
+	}
+}
+
+
+// GetComparisonModels lists the models a comparison can include
+func (h *ComparisonHandlers) GetComparisonModels(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"models": h.comparisonService.Labels()})
+}
+
+
+// StreamComparison sends a stored message to several models at once and
+// streams their answers as JSON SSE events tagged by model. Unlike a
+// generation, the answers are not stored and the stream cannot be resumed.
+func (h *ComparisonHandlers) StreamComparison(c *gin.Context) {
+	userId := c.Query("userId")
+	messageId := c.Query("messageId")
+
+	if userId == "" || messageId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId and messageId parameters are required"})
+		return
+	}
+
+	message, exists := h.messageService.GetMessageById(messageId)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	if message.UserId != userId {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Message does not belong to the specified user"})
+		return
+	}
+
+	targets, err := h.comparisonService.Select(utils.SplitList(c.Query("models")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request, status, err := newGenerationRequest(message, h.messageService, h.promptService, h.modelPolicyService)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Writer.Flush()
+
+	// Every model writes into the same log, so their deltas are
+	// interleaved in the order they arrive
+	events := services.NewEventLog(0)
+	sub := events.Subscribe(0)
+	defer sub.Close()
+
+	go h.comparisonService.Compare(c.Request.Context(), message.MessageId, request, targets, events)
+	relayEvents(c.Request.Context(), sub, c.Writer, jsonStreamWriter{}, h.streamConfig)
+}
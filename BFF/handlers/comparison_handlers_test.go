@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bff/models"
+	"bff/services"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// modelRecordingProvider remembers the model each stream was asked for
+type modelRecordingProvider struct {
+	services.FakeProvider
+	models chan string
+}
+
+func (p *modelRecordingProvider) StreamCompletion(ctx context.Context, request models.ChatRequest, responseChan chan<- models.StreamChunk, errorChan chan<- error) {
+	p.models <- request.Model
+	p.FakeProvider.StreamCompletion(ctx, request, responseChan, errorChan)
+}
+
+func TestStreamComparison(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newMessageServices(t)
+	s.modelPolicy = services.NewModelPolicyService([]string{"gpt-4o"}, services.ModelPolicyConfig{})
+
+	healthy := &modelRecordingProvider{FakeProvider: services.FakeProvider{ProviderName: "healthy"}, models: make(chan string, 1)}
+	broken := &services.FakeProvider{ProviderName: "broken", Err: &services.UpstreamError{StatusCode: 500, Message: "upstream down"}}
+	comparisonService := services.NewComparisonService([]services.ComparisonTarget{{Provider: healthy}, {Provider: broken}})
+	h := NewComparisonHandlers(s.messages, s.prompts, s.modelPolicy, comparisonService, StreamConfig{})
+
+	router := gin.New()
+	router.GET("/compare", h.StreamComparison)
+
+	message, _, _, err := s.save(models.UserMessageDTO{Message: "Hi there", UserId: "u1", Model: "gpt-4o"})
+	require.NoError(t, err)
+
+	t.Run("should stream every answer even when one model fails", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/compare?userId=u1&messageId="+message.MessageId, nil))
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "event: delta\ndata: {\"v\":1,\"model\":\"healthy\",\"index\":0,\"content\":\"You \"}")
+
+		// The model picked for the message belongs to the default provider
+		assert.Equal(t, "", <-healthy.models)
+
+		body := w.Body.String()
+		index := strings.LastIndex(body, "event: summary\ndata: ")
+		require.NotEqual(t, -1, index, body)
+		var summary models.ComparisonSummary
+		data := strings.TrimSpace(strings.TrimPrefix(body[index:], "event: summary\ndata: "))
+		require.NoError(t, json.Unmarshal([]byte(data), &summary))
+
+		require.Len(t, summary.Results, 2)
+		assert.Equal(t, "healthy", summary.Results[0].Model)
+		assert.Equal(t, "stop", summary.Results[0].FinishReason)
+		assert.Equal(t, 4, summary.Results[0].Usage.CompletionTokens)
+		assert.Empty(t, summary.Results[0].Error)
+
+		assert.Equal(t, "broken", summary.Results[1].Model)
+		assert.Equal(t, "error", summary.Results[1].FinishReason)
+		assert.NotEmpty(t, summary.Results[1].ErrorCode)
+		assert.Contains(t, summary.Results[1].Error, "upstream down")
+	})
+
+	t.Run("should reject a message of another user and unknown models", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/compare?userId=u2&messageId="+message.MessageId, nil))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/compare?userId=u1&models=gpt-4o&messageId="+message.MessageId, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
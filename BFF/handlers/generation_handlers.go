@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"bff/models"
+	"bff/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GenerationHandlers struct {
+	messageService     *services.MessageService
+	promptService      *services.PromptService
+	modelPolicyService *services.ModelPolicyService
+	generationService  *services.GenerationService
+	provider           services.Provider
+	streamConfig       StreamConfig
+}
+
+func NewGenerationHandlers(messageService *services.MessageService, promptService *services.PromptService, modelPolicyService *services.ModelPolicyService, generationService *services.GenerationService, provider services.Provider, streamConfig StreamConfig) *GenerationHandlers {
+	return &GenerationHandlers{
+		messageService:     messageService,
+		promptService:      promptService,
+		modelPolicyService: modelPolicyService,
+		generationService:  generationService,
+		provider:           provider,
+		streamConfig:       streamConfig,
+	}
+}
+
+// PostGeneration starts a background generation answering a message. It
+// runs to completion even if nobody is listening, and the answer is stored
+// against the message.
+func (h *GenerationHandlers) PostGeneration(c *gin.Context) {
+	var req models.StartGenerationDTO
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON. Expected { \"userId\": \"user123\", \"messageId\": \"msg_123\" }"})
+		return
+	}
+
+	if req.UserId == "" || req.MessageId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "UserId and MessageId cannot be empty"})
+		return
+	}
+
+	message, exists := h.messageService.GetMessageById(req.MessageId)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	if message.UserId != req.UserId {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Message does not belong to the specified user"})
+		return
+	}
+
+	request, status, err := newGenerationRequest(message, h.messageService, h.promptService, h.modelPolicyService)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	gen := h.generationService.StartBackground(req.UserId, message.MessageId, request)
+	c.JSON(http.StatusAccepted, gen.Snapshot())
+}
+
+// GetGeneration returns the status and answer so far of a generation
+func (h *GenerationHandlers) GetGeneration(c *gin.Context) {
+	gen, ok := h.userGeneration(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gen.Snapshot())
+}
+
+// StreamGeneration attaches to a generation's event stream, replaying it
+// from the start or from Last-Event-ID
+func (h *GenerationHandlers) StreamGeneration(c *gin.Context) {
+	gen, ok := h.userGeneration(c)
+	if !ok {
+		return
+	}
+
+	writer, err := newStreamWriter(c.Query("format"), h.provider.Name())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lastEventId, _, err := lastEventIdFrom(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	streamGeneration(c, h.generationService, gen, writer, lastEventId, h.streamConfig)
+}
+
+// CancelGeneration stops an in-flight generation. The stream it belongs to
+// records the partial answer as cancelled and ends with a cancelled event.
+func (h *GenerationHandlers) CancelGeneration(c *gin.Context) {
+	var req models.CancelGenerationDTO
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON. Expected { \"userId\": \"user123\" }"})
+		return
+	}
+
+	if req.UserId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "UserId cannot be empty"})
+		return
+	}
+
+	generationId := c.Param("id")
+	if !h.generationService.Cancel(generationId, req.UserId) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No in-flight generation with this ID for the specified user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"generationId": generationId,
+		"status":       "cancelled",
+	})
+}
+
+// userGeneration looks up the generation in the path for the user in the
+// userId query parameter, writing the error response if that fails
+func (h *GenerationHandlers) userGeneration(c *gin.Context) (*services.Generation, bool) {
+	userId := c.Query("userId")
+	if userId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId parameter is required"})
+		return nil, false
+	}
+
+	gen, exists := h.generationService.Get(c.Param("id"))
+	if !exists || gen.UserId != userId {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No generation with this ID for the specified user"})
+		return nil, false
+	}
+	return gen, true
+}
+
+// newGenerationRequest checks that a message may be answered right now and
+// builds its chat request, with the status code to fail with otherwise.
+func newGenerationRequest(message *models.MessageUserTable, messageService *services.MessageService, promptService *services.PromptService, modelPolicyService *services.ModelPolicyService) (models.ChatRequest, int, error) {
+	if message.Moderation == models.KeywordActionBlock {
+		return models.ChatRequest{}, http.StatusForbidden, errors.New("Message contains forbidden keywords")
+	}
+	switch message.Review {
+	case models.ReviewPending:
+		return models.ChatRequest{}, http.StatusForbidden, errors.New("Message is held for review")
+	case models.ReviewRejected:
+		return models.ChatRequest{}, http.StatusForbidden, errors.New("Message was rejected by a moderator")
+	}
+
+	// The allowlist may have changed since the message was posted
+	if err := modelPolicyService.Validate(message.Model, message.Params); err != nil {
+		return models.ChatRequest{}, http.StatusForbidden, err
+	}
+
+	systemPrompt, err := promptService.Render(message.UserId, message.Prompt)
+	if errors.Is(err, services.ErrUnknownPromptTemplate) {
+		// The template was removed by a reload since the message was posted
+		return models.ChatRequest{}, http.StatusBadRequest, err
+	}
+	if err != nil {
+		return models.ChatRequest{}, http.StatusInternalServerError, err
+	}
+
+	request := services.NewChatRequest(systemPrompt, messageService.BuildChatMessages(*message))
+	request.Model = message.Model
+	request.Params = message.Params
+	return request, http.StatusOK, nil
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bff/models"
+	"bff/services"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGenerationRouter serves the background generation routes. The fake
+// provider waits chunkDelay between words.
+func newGenerationRouter(t *testing.T, chunkDelay time.Duration) (*gin.Engine, messageServices) {
+	gin.SetMode(gin.TestMode)
+	s := newMessageServices(t)
+	provider := services.NewFakeProvider("")
+	provider.ChunkDelay = chunkDelay
+	generationService := services.NewGenerationService(s.messages, provider, services.GenerationConfig{Retention: time.Minute})
+	h := NewGenerationHandlers(s.messages, s.prompts, s.modelPolicy, generationService, provider, StreamConfig{})
+
+	router := gin.New()
+	router.POST("/generations", h.PostGeneration)
+	router.GET("/generations/:id", h.GetGeneration)
+	router.GET("/generations/:id/events", h.StreamGeneration)
+	router.POST("/generations/:id/cancel", h.CancelGeneration)
+	return router, s
+}
+
+func serve(router *gin.Engine, method string, path string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+// startGeneration answers a new message of user u1 in the background
+func startGeneration(t *testing.T, router *gin.Engine, s messageServices) models.GenerationStatus {
+	message, _, _, err := s.save(models.UserMessageDTO{Message: "Tell me a story", UserId: "u1"})
+	require.NoError(t, err)
+
+	w := serve(router, http.MethodPost, "/generations", `{"userId":"u1","messageId":"`+message.MessageId+`"}`)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+	var status models.GenerationStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	return status
+}
+
+func TestGenerationHandlers(t *testing.T) {
+	t.Run("should answer a message in the background", func(t *testing.T) {
+		router, s := newGenerationRouter(t, 0)
+
+		started := startGeneration(t, router, s)
+		assert.Equal(t, services.GenerationRunning, started.Status)
+
+		var status models.GenerationStatus
+		require.Eventually(t, func() bool {
+			w := serve(router, http.MethodGet, "/generations/"+started.GenerationId+"?userId=u1", "")
+			return json.Unmarshal(w.Body.Bytes(), &status) == nil && status.Status == services.GenerationCompleted
+		}, time.Second, 5*time.Millisecond)
+		assert.Equal(t, "You said: Tell me a story", status.Content)
+	})
+
+	t.Run("should refuse to answer another user's message", func(t *testing.T) {
+		router, s := newGenerationRouter(t, 0)
+		message, _, _, err := s.save(models.UserMessageDTO{Message: "Hi", UserId: "u1"})
+		require.NoError(t, err)
+
+		w := serve(router, http.MethodPost, "/generations", `{"userId":"u2","messageId":"`+message.MessageId+`"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "Message does not belong to the specified user")
+
+		assert.Equal(t, http.StatusNotFound, serve(router, http.MethodPost, "/generations", `{"userId":"u1","messageId":"msg_unknown"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, serve(router, http.MethodPost, "/generations", `{"userId":"u1"}`).Code)
+	})
+
+	t.Run("should hide generations from other users", func(t *testing.T) {
+		router, s := newGenerationRouter(t, 50*time.Millisecond)
+		started := startGeneration(t, router, s)
+
+		assert.Equal(t, http.StatusNotFound, serve(router, http.MethodGet, "/generations/"+started.GenerationId+"?userId=u2", "").Code)
+		assert.Equal(t, http.StatusNotFound, serve(router, http.MethodGet, "/generations/"+started.GenerationId+"/events?userId=u2", "").Code)
+
+		w := serve(router, http.MethodPost, "/generations/"+started.GenerationId+"/cancel", `{"userId":"u2"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "No in-flight generation with this ID for the specified user")
+
+		assert.Equal(t, http.StatusBadRequest, serve(router, http.MethodPost, "/generations/"+started.GenerationId+"/cancel", `{}`).Code)
+	})
+
+	t.Run("should end a cancelled generation with a cancelled event", func(t *testing.T) {
+		router, s := newGenerationRouter(t, 50*time.Millisecond)
+		started := startGeneration(t, router, s)
+
+		w := serve(router, http.MethodPost, "/generations/"+started.GenerationId+"/cancel", `{"userId":"u1"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"cancelled"`)
+
+		w = serve(router, http.MethodGet, "/generations/"+started.GenerationId+"/events?userId=u1", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "event: done\ndata: {\"v\":1,\"finishReason\":\"cancelled\"")
+
+		w = serve(router, http.MethodGet, "/generations/"+started.GenerationId+"/events?userId=u1&format=text", "")
+		assert.Contains(t, w.Body.String(), "event: cancelled\ndata: Generation cancelled\n\n")
+
+		response, exists := s.messages.GetResponse(started.MessageId)
+		require.True(t, exists)
+		assert.Equal(t, "cancelled", response.FinishReason)
+
+		assert.Equal(t, http.StatusNotFound, serve(router, http.MethodPost, "/generations/"+started.GenerationId+"/cancel", `{"userId":"u1"}`).Code)
+	})
+}
+
+func TestNewGenerationRequest(t *testing.T) {
+	t.Run("should reject a message whose template was removed", func(t *testing.T) {
+		s := newMessageServices(t)
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "formal.tmpl"), []byte("Be formal."), 0o644))
+		var err error
+		s.prompts, err = services.NewPromptService(dir)
+		require.NoError(t, err)
+
+		message, _, _, err := s.save(models.UserMessageDTO{Message: "Hi", UserId: "u1", Prompt: models.PromptOptions{Template: "formal"}})
+		require.NoError(t, err)
+		require.NoError(t, os.Remove(filepath.Join(dir, "formal.tmpl")))
+		require.NoError(t, s.prompts.Reload())
+
+		_, status, err := newGenerationRequest(&message, s.messages, s.prompts, s.modelPolicy)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.ErrorContains(t, err, `unknown prompt template "formal"`)
+	})
+}
@@ -38,7 +38,18 @@ func (h *KeywordHandlers) PostKeywords(c *gin.Context) {
 		return
 	}
 
-	h.keywordService.AddWords(req.Keywords)
+	rule := models.KeywordRule{
+		Category: req.Category,
+		Severity: req.Severity,
+		Action:   req.Action,
+	}
+	if err := h.keywordService.AddRules(req.Keywords, rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Lemmatized keywords added",
 		"count":   len(req.Keywords),
@@ -50,3 +61,32 @@ func (h *KeywordHandlers) GetKeywords(c *gin.Context) {
 	keywords := h.keywordService.GetAllKeywords()
 	c.JSON(http.StatusOK, keywords)
 }
+
+
+func (h *KeywordHandlers) GetKeywordRules(c *gin.Context) {
+	rules := h.keywordService.GetRules()
+	c.JSON(http.StatusOK, rules)
+}
+
+
+// PostModerate checks a text for keywords the way posted messages are
+// checked, without storing anything
+func (h *KeywordHandlers) PostModerate(c *gin.Context) {
+	var req models.ModerationRequest
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid JSON. Expected { \"text\": \"...\" }",
+		})
+		return
+	}
+
+	if req.Text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The 'text' field cannot be empty.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.keywordService.Moderate(req.Text))
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bff/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostModerate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newMessageServices(t)
+	s.keywords.AddWords([]string{"spam"})
+	require.NoError(t, s.keywords.AddRules([]string{"acme"}, models.KeywordRule{Category: "competitor", Severity: models.KeywordSeverityLow, Action: models.KeywordActionWarn}))
+	require.NoError(t, s.keywords.AddRules([]string{"password"}, models.KeywordRule{Category: "pii", Severity: models.KeywordSeverityMedium, Action: models.KeywordActionRedact}))
+
+	router := gin.New()
+	router.POST("/moderate", NewKeywordHandlers(s.keywords).PostModerate)
+
+	moderate := func(body string) (int, models.ModerationResult) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/moderate", strings.NewReader(body)))
+		var result models.ModerationResult
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		}
+		return w.Code, result
+	}
+
+	t.Run("should approve a text without keywords", func(t *testing.T) {
+		code, result := moderate(`{"text":"Hello there"}`)
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, models.VerdictApproved, result.Verdict)
+		assert.Empty(t, result.Action)
+		assert.Empty(t, result.FoundKeywords)
+	})
+
+	t.Run("should report the strictest rule and every category", func(t *testing.T) {
+		code, result := moderate(`{"text":"Acme wants my password"}`)
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, models.VerdictRedacted, result.Verdict)
+		assert.Equal(t, models.KeywordActionRedact, result.Action)
+		assert.Equal(t, models.KeywordSeverityMedium, result.Severity)
+		assert.ElementsMatch(t, []string{"competitor", "pii"}, result.Categories)
+		assert.ElementsMatch(t, []string{"acme", "password"}, result.FoundKeywords)
+		assert.Equal(t, "Acme wants my [REDACTED]", result.RedactedText)
+	})
+
+	t.Run("should block a text with a forbidden keyword", func(t *testing.T) {
+		code, result := moderate(`{"text":"Buy spam and acme"}`)
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, models.VerdictBlocked, result.Verdict)
+		assert.Equal(t, models.KeywordActionBlock, result.Action)
+		require.Len(t, result.Matches, 2)
+		assert.Equal(t, "spam", result.Matches[0].Text)
+		assert.Empty(t, result.RedactedText)
+	})
+
+	t.Run("should reject an empty text", func(t *testing.T) {
+		code, _ := moderate(`{"text":""}`)
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		code, _ = moderate(`{"text":`)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
@@ -3,8 +3,10 @@ package handlers
 import (
 	"bff/models"
 	"bff/services"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,15 +14,19 @@ import (
 
 
 type MessageHandlers struct {
-	messageService *services.MessageService
-	keywordService *services.KeywordService
+	messageService     *services.MessageService
+	keywordService     *services.KeywordService
+	promptService      *services.PromptService
+	modelPolicyService *services.ModelPolicyService
 }
 
 
-func NewMessageHandlers(messageService *services.MessageService, keywordService *services.KeywordService) *MessageHandlers {
+func NewMessageHandlers(messageService *services.MessageService, keywordService *services.KeywordService, promptService *services.PromptService, modelPolicyService *services.ModelPolicyService) *MessageHandlers {
 	return &MessageHandlers{
-		messageService: messageService,
-		keywordService: keywordService,
+		messageService:     messageService,
+		keywordService:     keywordService,
+		promptService:      promptService,
+		modelPolicyService: modelPolicyService,
 	}
 }
 
@@ -33,51 +39,160 @@ func (h *MessageHandlers) PostMessage(c *gin.Context) {
 		return
 	}
 
-	if newMessage.Message == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Message cannot be empty"})
+	message, moderation, status, err := saveUserMessage(newMessage, h.messageService, h.keywordService, h.promptService, h.modelPolicyService)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	if len(newMessage.Message) > int(h.messageService.GetCharLimit()) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Character Size"})
+	switch moderation.Verdict {
+	case models.VerdictBlocked:
+		// Message contains forbidden keywords - return 400
+		c.JSON(http.StatusBadRequest, flaggedMessageResponse(message, moderation))
 		return
+	case models.VerdictHeld:
+		c.JSON(http.StatusAccepted, heldMessageResponse(message, moderation))
+		return
+	}
+
+
+	c.JSON(http.StatusOK, withModeration(gin.H{
+		"messageId":      message.MessageId,
+		"conversationId": message.ConversationId,
+		"message":        "Message posted successfully",
+		// Every answerable verdict is approved; the verdict tells them apart
+		"status":         "approved",
+	}, moderation))
+}
+
+
+// saveUserMessage validates a posted message and stores it along with the
+// action its keyword rules take, which comes back with the matches. A
+// rejected message is not stored and comes back as an error with the status
+// code to fail with.
+func saveUserMessage(newMessage models.UserMessageDTO, messageService *services.MessageService, keywordService *services.KeywordService, promptService *services.PromptService, modelPolicyService *services.ModelPolicyService) (models.MessageUserTable, models.ModerationResult, int, error) {
+	if newMessage.Message == "" {
+		return models.MessageUserTable{}, models.ModerationResult{}, http.StatusBadRequest, errors.New("Message cannot be empty")
+	}
+
+	if len(newMessage.Message) > int(messageService.GetCharLimit()) {
+		return models.MessageUserTable{}, models.ModerationResult{}, http.StatusBadRequest, errors.New("Invalid Character Size")
 	}
 
 	if newMessage.UserId == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "UserId cannot be empty"})
-		return
+		return models.MessageUserTable{}, models.ModerationResult{}, http.StatusBadRequest, errors.New("UserId cannot be empty")
 	}
 
 
-	foundKeywords := h.keywordService.CheckTextForKeywords(newMessage.Message)
+	if newMessage.Prompt.Template != "" && !promptService.HasTemplate(newMessage.Prompt.Template) {
+		return models.MessageUserTable{}, models.ModerationResult{}, http.StatusBadRequest, errors.New("Unknown prompt template")
+	}
+
+	if err := checkPromptOptions(newMessage.Prompt, messageService.GetCharLimit(), keywordService); err != nil {
+		return models.MessageUserTable{}, models.ModerationResult{}, http.StatusBadRequest, err
+	}
+
+	if err := modelPolicyService.Validate(newMessage.Model, newMessage.Params); err != nil {
+		return models.MessageUserTable{}, models.ModerationResult{}, http.StatusBadRequest, err
+	}
+
+	if newMessage.ConversationId == "" {
+		newMessage.ConversationId = generateConversationID()
+	} else if owner, exists := messageService.GetConversationOwner(newMessage.ConversationId); exists && owner != newMessage.UserId {
+		return models.MessageUserTable{}, models.ModerationResult{}, http.StatusForbidden, errors.New("Conversation does not belong to the specified user")
+	}
+
+
+	moderation := keywordService.Moderate(newMessage.Message)
 
 	message := models.MessageUserTable{
-		MessageId:      generateMessageID(),
-		UserId:         newMessage.UserId,
-		Flagged:        len(foundKeywords) > 0,
-		MessageContent: newMessage.Message,
+		MessageId:       generateMessageID(),
+		ConversationId:  newMessage.ConversationId,
+		UserId:          newMessage.UserId,
+		Flagged:         moderation.Verdict != models.VerdictApproved && moderation.Verdict != models.VerdictWarned,
+		Moderation:      moderation.Action,
+		MessageContent:  newMessage.Message,
+		RedactedContent: moderation.RedactedText,
+		Prompt:          newMessage.Prompt,
+		Model:           newMessage.Model,
+		Params:          newMessage.Params,
+	}
+	if moderation.Action == models.KeywordActionReview {
+		message.Review = models.ReviewPending
 	}
 
 
-	h.messageService.AddMessage(message)
+	messageService.AddMessage(message)
+	return message, moderation, http.StatusOK, nil
+}
 
-	if len(foundKeywords) > 0 {
-		// Message contains forbidden keywords - return 400
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":         "Message contains forbidden keywords",
-			"messageId":     message.MessageId,
-			"foundKeywords": foundKeywords,
-			"message":       "Your message has been saved but contains prohibited content",
-		})
-		return
+
+// checkPromptOptions holds the free-form prompt fields, which end up in the
+// system prompt, to the character limit and keyword rules of the message.
+// Unlike the message they can't be stored flagged or redacted, so any rule
+// stricter than a warning rejects them.
+func checkPromptOptions(prompt models.PromptOptions, charLimit int16, keywordService *services.KeywordService) error {
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"userName", prompt.UserName},
+		{"locale", prompt.Locale},
+		{"context", prompt.Context},
 	}
 
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if len(field.value) > int(charLimit) {
+			return fmt.Errorf("Invalid Character Size in prompt %s", field.name)
+		}
+
+		moderation := keywordService.Moderate(field.value)
+		if moderation.Verdict != models.VerdictApproved && moderation.Verdict != models.VerdictWarned {
+			return fmt.Errorf("Prompt %s contains forbidden keywords: %s", field.name, strings.Join(moderation.FoundKeywords, ", "))
+		}
+	}
+	return nil
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"messageId": message.MessageId,
-		"message":   "Message posted successfully",
-		"status":    "approved",
-	})
+
+func flaggedMessageResponse(message models.MessageUserTable, moderation models.ModerationResult) gin.H {
+	return withModeration(gin.H{
+		"error":          "Message contains forbidden keywords",
+		"messageId":      message.MessageId,
+		"conversationId": message.ConversationId,
+		"message":        "Your message has been saved but contains prohibited content",
+	}, moderation)
+}
+
+
+func heldMessageResponse(message models.MessageUserTable, moderation models.ModerationResult) gin.H {
+	return withModeration(gin.H{
+		"messageId":      message.MessageId,
+		"conversationId": message.ConversationId,
+		"message":        "Your message has been saved and is held for review",
+	}, moderation)
+}
+
+
+// withModeration adds the verdict to a response, and what the keyword rules
+// found if they found anything
+func withModeration(response gin.H, moderation models.ModerationResult) gin.H {
+	response["verdict"] = moderation.Verdict
+	if moderation.Action == "" {
+		return response
+	}
+	response["action"] = moderation.Action
+	response["severity"] = moderation.Severity
+	response["categories"] = moderation.Categories
+	response["foundKeywords"] = moderation.FoundKeywords
+	response["matches"] = moderation.Matches
+	if moderation.RedactedText != "" {
+		response["redactedText"] = moderation.RedactedText
+	}
+	return response
 }
 
 
@@ -86,10 +201,55 @@ func generateMessageID() string {
 	return fmt.Sprintf("msg_%d", time.Now().UnixNano())
 }
 
+func generateConversationID() string {
+	return fmt.Sprintf("conv_%d", time.Now().UnixNano())
+}
+
 
 func (h *MessageHandlers) GetMessages(c *gin.Context) {
-	messages := h.messageService.GetAllMessages()
-	c.JSON(http.StatusOK, messages)
+	pairs := h.messageService.GetMessagePairs()
+	c.JSON(http.StatusOK, pairs)
+}
+
+
+// GetHeldMessages lists the messages waiting for a moderator
+func (h *MessageHandlers) GetHeldMessages(c *gin.Context) {
+	c.JSON(http.StatusOK, h.messageService.GetHeldMessages())
+}
+
+
+// ApproveMessage releases a held message, so it can be answered like any
+// other
+func (h *MessageHandlers) ApproveMessage(c *gin.Context) {
+	h.reviewMessage(c, models.ReviewApproved)
+}
+
+
+// RejectMessage keeps a held message from ever being answered
+func (h *MessageHandlers) RejectMessage(c *gin.Context) {
+	h.reviewMessage(c, models.ReviewRejected)
+}
+
+
+func (h *MessageHandlers) reviewMessage(c *gin.Context, review string) {
+	messageId := c.Param("id")
+	if _, exists := h.messageService.GetMessageById(messageId); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	message, ok := h.messageService.ReviewMessage(messageId, review)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "Message is not held for review"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messageId":      message.MessageId,
+		"conversationId": message.ConversationId,
+		"userId":         message.UserId,
+		"review":         message.Review,
+	})
 }
 
 
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bff/models"
+	"bff/services"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// messageServices are the services saveUserMessage checks a message with
+type messageServices struct {
+	messages    *services.MessageService
+	keywords    *services.KeywordService
+	prompts     *services.PromptService
+	modelPolicy *services.ModelPolicyService
+}
+
+func newMessageServices(t *testing.T) messageServices {
+	keywordService, err := services.NewKeywordService(nil, nil)
+	require.NoError(t, err)
+	promptService, err := services.NewPromptService(t.TempDir())
+	require.NoError(t, err)
+
+	return messageServices{
+		messages:    services.NewMessageService(),
+		keywords:    keywordService,
+		prompts:     promptService,
+		modelPolicy: services.NewModelPolicyService(nil, services.ModelPolicyConfig{}),
+	}
+}
+
+func (s messageServices) save(newMessage models.UserMessageDTO) (models.MessageUserTable, models.ModerationResult, int, error) {
+	return saveUserMessage(newMessage, s.messages, s.keywords, s.prompts, s.modelPolicy)
+}
+
+func TestSaveUserMessage(t *testing.T) {
+	t.Run("should check the prompt fields like the message", func(t *testing.T) {
+		s := newMessageServices(t)
+		s.keywords.AddWords([]string{"spam"})
+		require.NoError(t, s.keywords.AddRules([]string{"acme"}, models.KeywordRule{Action: models.KeywordActionWarn}))
+
+		_, _, status, err := s.save(models.UserMessageDTO{Message: "Hi", UserId: "u1", Prompt: models.PromptOptions{Context: "Buy spam now"}})
+		assert.Equal(t, 400, status)
+		assert.ErrorContains(t, err, "Prompt context contains forbidden keywords: spam")
+
+		_, _, status, err = s.save(models.UserMessageDTO{Message: "Hi", UserId: "u1", Prompt: models.PromptOptions{UserName: strings.Repeat("a", int(s.messages.GetCharLimit())+1)}})
+		assert.Equal(t, 400, status)
+		assert.ErrorContains(t, err, "Invalid Character Size in prompt userName")
+
+		_, _, _, err = s.save(models.UserMessageDTO{Message: "Hi", UserId: "u1", Prompt: models.PromptOptions{Context: "Acme sells widgets"}})
+		assert.NoError(t, err)
+		assert.Len(t, s.messages.GetAllMessages(), 1)
+	})
+}
+
+func TestPostMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newMessageServices(t)
+	s.keywords.AddWords([]string{"spam"})
+	require.NoError(t, s.keywords.AddRules([]string{"acme"}, models.KeywordRule{Action: models.KeywordActionWarn}))
+	require.NoError(t, s.keywords.AddRules([]string{"secret"}, models.KeywordRule{Action: models.KeywordActionRedact}))
+
+	router := gin.New()
+	router.POST("/messages", NewMessageHandlers(s.messages, s.keywords, s.prompts, s.modelPolicy).PostMessage)
+
+	post := func(text string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/messages", strings.NewReader(`{"userId":"u1","message":"`+text+`"}`)))
+		var response map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	t.Run("should approve every answerable message and report its verdict", func(t *testing.T) {
+		for text, verdict := range map[string]string{
+			"Hi there":          models.VerdictApproved,
+			"Acme sells things": models.VerdictWarned,
+			"My secret is 1234": models.VerdictRedacted,
+		} {
+			code, response := post(text)
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, "approved", response["status"], text)
+			assert.Equal(t, verdict, response["verdict"], text)
+		}
+	})
+
+	t.Run("should report the verdict of a rejected message", func(t *testing.T) {
+		code, response := post("Buy spam")
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, models.VerdictBlocked, response["verdict"])
+		assert.NotContains(t, response, "status")
+	})
+}
+
+func TestReviewHeldMessages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newMessageServices(t)
+	require.NoError(t, s.keywords.AddRules([]string{"password"}, models.KeywordRule{Action: models.KeywordActionReview}))
+	h := NewMessageHandlers(s.messages, s.keywords, s.prompts, s.modelPolicy)
+
+	router := gin.New()
+	router.GET("/held-messages", h.GetHeldMessages)
+	router.POST("/held-messages/:id/approve", h.ApproveMessage)
+	router.POST("/held-messages/:id/reject", h.RejectMessage)
+
+	request := func(method string, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	hold := func() *models.MessageUserTable {
+		message, moderation, _, err := s.save(models.UserMessageDTO{Message: "My password is hunter2", UserId: "u1"})
+		require.NoError(t, err)
+		require.Equal(t, models.VerdictHeld, moderation.Verdict)
+		return &message
+	}
+	answerable := func(messageId string) error {
+		message, exists := s.messages.GetMessageById(messageId)
+		require.True(t, exists)
+		_, _, err := newGenerationRequest(message, s.messages, s.prompts, s.modelPolicy)
+		return err
+	}
+
+	t.Run("should list held messages until a moderator approves them", func(t *testing.T) {
+		message := hold()
+		assert.EqualError(t, answerable(message.MessageId), "Message is held for review")
+
+		w := request(http.MethodGet, "/held-messages")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), message.MessageId)
+
+		w = request(http.MethodPost, "/held-messages/"+message.MessageId+"/approve")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"review":"approved"`)
+		assert.NoError(t, answerable(message.MessageId))
+		assert.NotContains(t, request(http.MethodGet, "/held-messages").Body.String(), message.MessageId)
+
+		assert.Equal(t, http.StatusConflict, request(http.MethodPost, "/held-messages/"+message.MessageId+"/reject").Code)
+	})
+
+	t.Run("should never answer rejected messages", func(t *testing.T) {
+		message := hold()
+
+		require.Equal(t, http.StatusOK, request(http.MethodPost, "/held-messages/"+message.MessageId+"/reject").Code)
+		assert.EqualError(t, answerable(message.MessageId), "Message was rejected by a moderator")
+	})
+
+	t.Run("should not review unknown messages", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, request(http.MethodPost, "/held-messages/msg_unknown/approve").Code)
+	})
+}
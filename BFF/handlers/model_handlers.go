@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"bff/models"
+	"bff/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+
+type ModelHandlers struct {
+	modelPolicyService *services.ModelPolicyService
+}
+
+
+func NewModelHandlers(modelPolicyService *services.ModelPolicyService) *ModelHandlers {
+	return &ModelHandlers{
+		modelPolicyService: modelPolicyService,
+	}
+}
+
+
+func (h *ModelHandlers) GetAllowedModels(c *gin.Context) {
+	c.JSON(http.StatusOK, h.modelPolicyService.GetAllowedModels())
+}
+
+
+func (h *ModelHandlers) PostAllowedModel(c *gin.Context) {
+	var limits models.ModelLimits
+
+	if err := c.BindJSON(&limits); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid JSON. Expected { \"model\": \"name\", \"maxTokens\": 1000, \"maxTemperature\": 1 }",
+		})
+		return
+	}
+
+	if limits.Model == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Model cannot be empty"})
+		return
+	}
+
+	if limits.MaxTokens < 0 || limits.MaxTemperature < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Limits cannot be negative"})
+		return
+	}
+
+	h.modelPolicyService.SetModelLimits(limits)
+	c.JSON(http.StatusCreated, limits)
+}
+
+
+func (h *ModelHandlers) DeleteAllowedModel(c *gin.Context) {
+	if !h.modelPolicyService.RemoveModel(c.Param("model")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Model not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"bff/models"
+	"bff/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+
+type PromptHandlers struct {
+	promptService *services.PromptService
+}
+
+
+func NewPromptHandlers(promptService *services.PromptService) *PromptHandlers {
+	return &PromptHandlers{
+		promptService: promptService,
+	}
+}
+
+
+func (h *PromptHandlers) GetPrompts(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"templates": h.promptService.GetTemplateNames(),
+	})
+}
+
+
+// ReloadPrompts re-reads the template files so edits apply without a restart
+func (h *PromptHandlers) ReloadPrompts(c *gin.Context) {
+	if err := h.promptService.Reload(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Prompt templates reloaded",
+		"templates": h.promptService.GetTemplateNames(),
+	})
+}
+
+
+func (h *PromptHandlers) PutUserPrompt(c *gin.Context) {
+	var req models.PromptTemplateDTO
+
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON. Expected { \"template\": \"name\" }"})
+		return
+	}
+
+	userId := c.Param("userId")
+	if err := h.promptService.SetUserTemplate(userId, req.Template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"userId":   userId,
+		"template": req.Template,
+	})
+}
+
+
+func (h *PromptHandlers) GetUserPrompt(c *gin.Context) {
+	userId := c.Param("userId")
+	c.JSON(http.StatusOK, gin.H{
+		"userId":   userId,
+		"template": h.promptService.GetUserTemplate(userId),
+	})
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"bff/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+
+type ProviderHandlers struct {
+	failoverProvider *services.FailoverProvider
+}
+
+
+func NewProviderHandlers(failoverProvider *services.FailoverProvider) *ProviderHandlers {
+	return &ProviderHandlers{
+		failoverProvider: failoverProvider,
+	}
+}
+
+
+// GetProviders lists the failover chain with each provider's breaker state
+func (h *ProviderHandlers) GetProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, h.failoverProvider.GetStatus())
+}
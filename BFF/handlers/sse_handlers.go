@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"bff/services"
-	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -10,15 +9,23 @@ import (
 
 
 type SSEHandlers struct {
-	messageService *services.MessageService
-	openaiService  *services.OpenAIService
+	messageService     *services.MessageService
+	promptService      *services.PromptService
+	modelPolicyService *services.ModelPolicyService
+	generationService  *services.GenerationService
+	provider           services.Provider
+	streamConfig       StreamConfig
 }
 
 
-func NewSSEHandlers(messageService *services.MessageService, openaiService *services.OpenAIService) *SSEHandlers {
+func NewSSEHandlers(messageService *services.MessageService, promptService *services.PromptService, modelPolicyService *services.ModelPolicyService, generationService *services.GenerationService, provider services.Provider, streamConfig StreamConfig) *SSEHandlers {
 	return &SSEHandlers{
-		messageService: messageService,
-		openaiService:  openaiService,
+		messageService:     messageService,
+		promptService:      promptService,
+		modelPolicyService: modelPolicyService,
+		generationService:  generationService,
+		provider:           provider,
+		streamConfig:       streamConfig,
 	}
 }
 
@@ -51,55 +58,38 @@ func (h *SSEHandlers) StreamCompletion(c *gin.Context) {
 		return
 	}
 
-	if message.Flagged {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Message contains forbidden keywords"})
+	writer, err := newStreamWriter(c.Query("format"), h.provider.Name())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
-	c.Header("Access-Control-Allow-Headers", "Cache-Control")
-
-
-	c.SSEvent("connection", "Connected to OpenAI stream")
-	c.Writer.Flush()
-
-
-	responseChan := make(chan string, 100)
-	errorChan := make(chan error, 1)
-
-
-	go h.openaiService.StreamCompletion(message.MessageContent, responseChan, errorChan)
-
-
-	for {
-		select {
-		case content, ok := <-responseChan:
-			if !ok {
-				// Channel closed, streaming finished
-				c.SSEvent("done", "Stream completed")
-				c.Writer.Flush()
-				return
-			}
-
-
-			c.SSEvent("data", content)
-			c.Writer.Flush()
-
-		case err := <-errorChan:
-			if err != nil {
-				// Send error to client
-				c.SSEvent("error", fmt.Sprintf("Error: %s", err.Error()))
-				c.Writer.Flush()
-				return
-			}
-
-		case <-c.Request.Context().Done():
-			// Client disconnected
+	// EventSource sends Last-Event-ID when it reconnects. Resume the
+	// buffered generation instead of asking the provider again.
+	var gen *services.Generation
+	lastEventId, resuming, err := lastEventIdFrom(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if resuming {
+		var exists bool
+		gen, exists = h.generationService.Latest(messageId)
+		if !exists {
+			c.JSON(http.StatusGone, gin.H{"error": "The generation for this message is no longer buffered"})
 			return
 		}
+	} else {
+		request, status, err := newGenerationRequest(message, h.messageService, h.promptService, h.modelPolicyService)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		// If another tab is already streaming this answer, share it
+		gen, _ = h.generationService.StartOrJoin(userId, message.MessageId, request)
 	}
+
+
+	streamGeneration(c, h.generationService, gen, writer, lastEventId, h.streamConfig)
 }
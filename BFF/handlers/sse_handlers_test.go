@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bff/models"
+	"bff/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sseServer struct {
+	router      *gin.Engine
+	services    messageServices
+	generations *services.GenerationService
+}
+
+func newSSEServer(t *testing.T, config services.GenerationConfig) sseServer {
+	gin.SetMode(gin.TestMode)
+	s := newMessageServices(t)
+	provider := services.NewFakeProvider("")
+	generationService := services.NewGenerationService(s.messages, provider, config)
+	h := NewSSEHandlers(s.messages, s.prompts, s.modelPolicy, generationService, provider, StreamConfig{})
+
+	router := gin.New()
+	router.GET("/ask-chatgpt", h.StreamCompletion)
+	return sseServer{router: router, services: s, generations: generationService}
+}
+
+// post stores a message of user u1 and returns its ID
+func (s sseServer) post(t *testing.T, text string) string {
+	message, _, _, err := s.services.save(models.UserMessageDTO{Message: text, UserId: "u1"})
+	require.NoError(t, err)
+	return message.MessageId
+}
+
+func (s sseServer) stream(messageId string, query string, lastEventId string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/ask-chatgpt?userId=u1&messageId="+messageId+query, nil)
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestStreamCompletion(t *testing.T) {
+	t.Run("should stream the answer as versioned JSON events", func(t *testing.T) {
+		server := newSSEServer(t, services.GenerationConfig{Retention: time.Minute})
+		messageId := server.post(t, "Hi there")
+
+		w := server.stream(messageId, "", "")
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+		assert.NotEmpty(t, w.Header().Get("X-Generation-Id"))
+		assert.Contains(t, w.Body.String(), "id: 1\nevent: meta\ndata: {\"v\":1,")
+		assert.Contains(t, w.Body.String(), "event: delta\ndata: {\"v\":1,\"index\":0,\"content\":\"You \"}")
+		assert.Contains(t, w.Body.String(), "event: done\ndata: {\"v\":1,\"finishReason\":\"stop\"")
+
+		response, exists := server.services.messages.GetResponse(messageId)
+		require.True(t, exists)
+		assert.Equal(t, "You said: Hi there", response.Content)
+	})
+
+	t.Run("should replay the events after Last-Event-ID without asking again", func(t *testing.T) {
+		server := newSSEServer(t, services.GenerationConfig{Retention: time.Minute})
+		messageId := server.post(t, "Hi there")
+		first := server.stream(messageId, "", "")
+		require.Equal(t, http.StatusOK, first.Code)
+
+		w := server.stream(messageId, "", "2")
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, first.Header().Get("X-Generation-Id"), w.Header().Get("X-Generation-Id"))
+		assert.NotContains(t, w.Body.String(), "id: 1\n")
+		assert.NotContains(t, w.Body.String(), "id: 2\n")
+		assert.Contains(t, w.Body.String(), "id: 3\n")
+		assert.Equal(t, strings.Count(first.Body.String(), "event: ")-2, strings.Count(w.Body.String(), "event: "))
+
+		w = server.stream(messageId, "&lastEventId=2", "")
+		assert.Equal(t, first.Header().Get("X-Generation-Id"), w.Header().Get("X-Generation-Id"))
+		assert.NotContains(t, w.Body.String(), "id: 2\n")
+	})
+
+	t.Run("should answer 410 once the generation is no longer buffered", func(t *testing.T) {
+		server := newSSEServer(t, services.GenerationConfig{Retention: 10 * time.Millisecond})
+		messageId := server.post(t, "Hi there")
+
+		assert.Equal(t, http.StatusGone, server.stream(messageId, "", "1").Code)
+
+		require.Equal(t, http.StatusOK, server.stream(messageId, "", "").Code)
+		require.Eventually(t, func() bool {
+			_, exists := server.generations.Latest(messageId)
+			return !exists
+		}, time.Second, 5*time.Millisecond)
+
+		w := server.stream(messageId, "", "3")
+		assert.Equal(t, http.StatusGone, w.Code)
+		assert.Contains(t, w.Body.String(), "The generation for this message is no longer buffered")
+	})
+
+	t.Run("should reject an invalid Last-Event-ID", func(t *testing.T) {
+		server := newSSEServer(t, services.GenerationConfig{})
+		messageId := server.post(t, "Hi there")
+
+		assert.Equal(t, http.StatusBadRequest, server.stream(messageId, "", "abc").Code)
+		assert.Equal(t, http.StatusBadRequest, server.stream(messageId, "", "-1").Code)
+	})
+
+	t.Run("should keep the legacy text events with format=text", func(t *testing.T) {
+		server := newSSEServer(t, services.GenerationConfig{})
+		messageId := server.post(t, "Hi there")
+
+		w := server.stream(messageId, "&format=text", "")
+
+		require.Equal(t, http.StatusOK, w.Code)
+		body := w.Body.String()
+		assert.Contains(t, body, "event: connection\ndata: Connected to fake stream\n\n")
+		assert.Contains(t, body, "event: generation\ndata: {\"generationId\":\""+w.Header().Get("X-Generation-Id")+"\"}")
+		assert.Contains(t, body, "event: data\ndata: You \n\n")
+		assert.Contains(t, body, "event: done\ndata: Stream completed\n\n")
+		assert.NotContains(t, body, "\"v\":1")
+
+		assert.Equal(t, http.StatusBadRequest, server.stream(messageId, "&format=xml", "").Code)
+	})
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"bff/models"
+	"bff/services"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+
+// StreamConfig tunes how generation events are relayed to streaming clients
+type StreamConfig struct {
+	// HeartbeatInterval is how long a stream may stay silent before a
+	// keep-alive is sent, so proxies don't close it. 0 disables heartbeats.
+	HeartbeatInterval time.Duration
+	// CoalesceWindow is how long deltas are held back so that a burst of
+	// them shares one flush. 0 flushes every event as it is written.
+	CoalesceWindow time.Duration
+	// CoalesceBytes flushes held back deltas early once this many bytes are
+	// pending. 0 leaves it to the window.
+	CoalesceBytes int
+}
+
+
+// flushWriter is the part of a streaming response the relay writes to
+type flushWriter interface {
+	io.Writer
+	http.Flusher
+}
+
+
+// relayEvents writes the subscription's backlog to out, then follows the
+// live tail until the log is closed, the subscriber is evicted or ctx is
+// done. An evicted client is disconnected and resumes with Last-Event-ID.
+func relayEvents(ctx context.Context, sub *services.Subscription, out flushWriter, writer streamWriter, config StreamConfig) {
+	relay := newStreamRelay(out, writer, config)
+	defer relay.Stop()
+
+	for _, event := range sub.Backlog() {
+		relay.Send(event)
+	}
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				relay.Flush()
+				if err := sub.Err(); err != nil {
+					log.Printf("Stopped streaming to a client: %v", err)
+				}
+				return
+			}
+			relay.Send(event)
+		case <-relay.FlushDue():
+			relay.Flush()
+		case <-relay.HeartbeatDue():
+			relay.Heartbeat()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+
+// streamRelay writes events to a streaming response and decides when to
+// flush them. Deltas are held back for the coalesce window, everything
+// else is flushed right away, and a heartbeat is sent whenever nothing was
+// flushed for the heartbeat interval.
+type streamRelay struct {
+	out     *countingWriter
+	flusher http.Flusher
+	writer  streamWriter
+	config  StreamConfig
+	// flushTimer runs while held back deltas wait for the window to close
+	flushTimer     *time.Timer
+	flushArmed     bool
+	heartbeatTimer *time.Timer
+}
+
+
+func newStreamRelay(out flushWriter, writer streamWriter, config StreamConfig) *streamRelay {
+	r := &streamRelay{
+		out:     &countingWriter{w: out},
+		flusher: out,
+		writer:  writer,
+		config:  config,
+	}
+	if config.HeartbeatInterval > 0 {
+		r.heartbeatTimer = time.NewTimer(config.HeartbeatInterval)
+	}
+	return r
+}
+
+
+// Send writes an event, flushing it unless it is a delta that may wait
+func (r *streamRelay) Send(event models.StreamEvent) {
+	if err := r.writer.Write(r.out, event); err != nil {
+		log.Printf("Failed to write %s event: %v", event.Type, err)
+		return
+	}
+
+	switch {
+	case event.Type != models.StreamEventDelta || r.config.CoalesceWindow <= 0:
+		r.Flush()
+	case r.config.CoalesceBytes > 0 && r.out.pending >= r.config.CoalesceBytes:
+		r.Flush()
+	case !r.flushArmed:
+		if r.flushTimer == nil {
+			r.flushTimer = time.NewTimer(r.config.CoalesceWindow)
+		} else {
+			r.flushTimer.Reset(r.config.CoalesceWindow)
+		}
+		r.flushArmed = true
+	}
+}
+
+
+// Flush sends everything written so far to the client
+func (r *streamRelay) Flush() {
+	if r.flushArmed {
+		r.flushTimer.Stop()
+		r.flushArmed = false
+	}
+	if r.out.pending == 0 {
+		return
+	}
+
+	r.flusher.Flush()
+	r.out.pending = 0
+	if r.heartbeatTimer != nil {
+		r.heartbeatTimer.Reset(r.config.HeartbeatInterval)
+	}
+}
+
+
+// Heartbeat sends a keep-alive. A failed one is retried after another
+// interval, since only a flush re-arms the timer otherwise.
+func (r *streamRelay) Heartbeat() {
+	if err := r.writer.Heartbeat(r.out); err != nil {
+		log.Printf("Failed to write heartbeat: %v", err)
+		r.heartbeatTimer.Reset(r.config.HeartbeatInterval)
+		return
+	}
+	r.Flush()
+}
+
+
+// FlushDue fires when held back deltas are due. It is nil while there
+// are none, so selecting on it blocks.
+func (r *streamRelay) FlushDue() <-chan time.Time {
+	if !r.flushArmed {
+		return nil
+	}
+	return r.flushTimer.C
+}
+
+
+// HeartbeatDue fires when the stream has been silent for the heartbeat
+// interval, and is nil when heartbeats are disabled
+func (r *streamRelay) HeartbeatDue() <-chan time.Time {
+	if r.heartbeatTimer == nil {
+		return nil
+	}
+	return r.heartbeatTimer.C
+}
+
+
+func (r *streamRelay) Stop() {
+	if r.flushTimer != nil {
+		r.flushTimer.Stop()
+	}
+	if r.heartbeatTimer != nil {
+		r.heartbeatTimer.Stop()
+	}
+}
+
+
+// countingWriter counts the bytes written since the last flush
+type countingWriter struct {
+	w       io.Writer
+	pending int
+}
+
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.pending += n
+	return n, err
+}
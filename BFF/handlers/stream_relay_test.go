@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bff/models"
+	"bff/services"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flushRecorder reports what each flush sent to the client
+type flushRecorder struct {
+	buf     bytes.Buffer
+	flushes chan string
+}
+
+func newFlushRecorder() *flushRecorder {
+	return &flushRecorder{flushes: make(chan string, 100)}
+}
+
+func (f *flushRecorder) Write(p []byte) (int, error) {
+	return f.buf.Write(p)
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushes <- f.buf.String()
+	f.buf.Reset()
+}
+
+// all returns the flushes so far, once relayEvents has returned
+func (f *flushRecorder) all() []string {
+	var flushes []string
+	for {
+		select {
+		case flush := <-f.flushes:
+			flushes = append(flushes, flush)
+		default:
+			return flushes
+		}
+	}
+}
+
+// flakyHeartbeatWriter fails its first heartbeat
+type flakyHeartbeatWriter struct {
+	jsonStreamWriter
+	failed bool
+}
+
+func (w *flakyHeartbeatWriter) Heartbeat(out io.Writer) error {
+	if !w.failed {
+		w.failed = true
+		return errors.New("write failed")
+	}
+	return w.jsonStreamWriter.Heartbeat(out)
+}
+
+func appendDeltas(events *services.EventLog, contents ...string) {
+	for i, content := range contents {
+		events.Append(models.StreamEventDelta, models.StreamDelta{Version: models.StreamEventVersion, Index: i, Content: content})
+	}
+}
+
+func TestRelayEvents(t *testing.T) {
+	t.Run("should flush every event without a coalesce window", func(t *testing.T) {
+		events := services.NewEventLog(0)
+		events.Append(models.StreamEventMeta, models.StreamMeta{Version: models.StreamEventVersion, GenerationId: "gen_1"})
+		appendDeltas(events, "Hello ", "there ", "world")
+		events.Append(models.StreamEventDone, models.StreamDone{Version: models.StreamEventVersion, FinishReason: "stop"})
+		events.Close()
+
+		out := newFlushRecorder()
+		relayEvents(context.Background(), events.Subscribe(0), out, ndjsonStreamWriter{}, StreamConfig{})
+
+		flushes := out.all()
+		require.Len(t, flushes, 5)
+		assert.Contains(t, flushes[1], `"content":"Hello "`)
+	})
+
+	t.Run("should send a burst of deltas in one flush", func(t *testing.T) {
+		events := services.NewEventLog(0)
+		events.Append(models.StreamEventMeta, models.StreamMeta{Version: models.StreamEventVersion, GenerationId: "gen_1"})
+		appendDeltas(events, "Hello ", "there ", "world")
+		events.Append(models.StreamEventDone, models.StreamDone{Version: models.StreamEventVersion, FinishReason: "stop"})
+		events.Close()
+
+		out := newFlushRecorder()
+		relayEvents(context.Background(), events.Subscribe(0), out, textStreamWriter{providerName: "fake"}, StreamConfig{CoalesceWindow: time.Hour})
+
+		flushes := out.all()
+		require.Len(t, flushes, 2)
+		assert.Equal(t, "id: 2\nevent: data\ndata: Hello \n\nid: 3\nevent: data\ndata: there \n\nid: 4\nevent: data\ndata: world\n\nid: 5\nevent: done\ndata: Stream completed\n\n", flushes[1])
+	})
+
+	t.Run("should flush early once enough bytes are pending", func(t *testing.T) {
+		events := services.NewEventLog(0)
+		appendDeltas(events, "aaaa", "bbbb", "cccc", "dddd")
+		events.Close()
+
+		out := newFlushRecorder()
+		relayEvents(context.Background(), events.Subscribe(0), out, textStreamWriter{}, StreamConfig{CoalesceWindow: time.Hour, CoalesceBytes: 60})
+
+		// Each delta is 33 bytes on the wire
+		flushes := out.all()
+		require.Len(t, flushes, 2)
+		assert.Contains(t, flushes[0], "aaaa")
+		assert.Contains(t, flushes[0], "bbbb")
+		assert.Contains(t, flushes[1], "cccc")
+		assert.Contains(t, flushes[1], "dddd")
+	})
+
+	t.Run("should flush held back deltas when the window closes", func(t *testing.T) {
+		events := services.NewEventLog(0)
+		appendDeltas(events, "Hello ", "there")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		out := newFlushRecorder()
+		go relayEvents(ctx, events.Subscribe(0), out, textStreamWriter{}, StreamConfig{CoalesceWindow: 10 * time.Millisecond})
+
+		select {
+		case flush := <-out.flushes:
+			assert.Equal(t, "id: 1\nevent: data\ndata: Hello \n\nid: 2\nevent: data\ndata: there\n\n", flush)
+		case <-time.After(time.Second):
+			t.Fatal("the deltas were never flushed")
+		}
+	})
+
+	t.Run("should send heartbeats while the generation is silent", func(t *testing.T) {
+		events := services.NewEventLog(0)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		out := newFlushRecorder()
+		go relayEvents(ctx, events.Subscribe(0), out, jsonStreamWriter{}, StreamConfig{HeartbeatInterval: 10 * time.Millisecond})
+
+		for range 2 {
+			select {
+			case flush := <-out.flushes:
+				assert.Equal(t, ": keep-alive\n\n", flush)
+			case <-time.After(time.Second):
+				t.Fatal("no heartbeat was sent")
+			}
+		}
+	})
+
+	t.Run("should keep sending heartbeats after one failed", func(t *testing.T) {
+		events := services.NewEventLog(0)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		out := newFlushRecorder()
+		go relayEvents(ctx, events.Subscribe(0), out, &flakyHeartbeatWriter{}, StreamConfig{HeartbeatInterval: 10 * time.Millisecond})
+
+		select {
+		case flush := <-out.flushes:
+			assert.Equal(t, ": keep-alive\n\n", flush)
+		case <-time.After(time.Second):
+			t.Fatal("no heartbeat was sent after the failed one")
+		}
+	})
+
+	t.Run("should resume after the last event ID", func(t *testing.T) {
+		events := services.NewEventLog(0)
+		appendDeltas(events, "Hello ", "there ", "world")
+		events.Close()
+
+		out := newFlushRecorder()
+		relayEvents(context.Background(), events.Subscribe(2), out, textStreamWriter{}, StreamConfig{CoalesceWindow: time.Hour})
+
+		assert.Equal(t, []string{"id: 3\nevent: data\ndata: world\n\n"}, out.all())
+	})
+}
+
+// BenchmarkRelayEvents streams a fast generation to a real HTTP client,
+// flushing every delta versus coalescing them with the default settings
+func BenchmarkRelayEvents(b *testing.B) {
+	const tokens = 2000
+
+	configs := []struct {
+		name   string
+		config StreamConfig
+	}{
+		{"flush every event", StreamConfig{}},
+		{"coalesced", StreamConfig{CoalesceWindow: 25 * time.Millisecond, CoalesceBytes: 4096}},
+	}
+
+	for _, tc := range configs {
+		b.Run(tc.name, func(b *testing.B) {
+			var events *services.EventLog
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sub := events.Subscribe(0)
+				defer sub.Close()
+				relayEvents(r.Context(), sub, w.(flushWriter), jsonStreamWriter{}, tc.config)
+			}))
+			defer server.Close()
+
+			for b.Loop() {
+				events = services.NewEventLog(tokens + 2)
+				go func() {
+					for i := range tokens {
+						events.Append(models.StreamEventDelta, models.StreamDelta{Version: models.StreamEventVersion, Index: i, Content: fmt.Sprintf("token%d ", i)})
+					}
+					events.Append(models.StreamEventDone, models.StreamDone{Version: models.StreamEventVersion, FinishReason: "stop"})
+					events.Close()
+				}()
+
+				resp, err := http.Get(server.URL)
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			b.ReportMetric(float64(tokens*b.N)/b.Elapsed().Seconds(), "tokens/s")
+		})
+	}
+}
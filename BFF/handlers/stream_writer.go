@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bff/models"
+	"bff/services"
+	"bff/sse"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+
+// streamGeneration sends the generation's events after lastEventId, then
+// follows the live tail until the generation ends or the client leaves.
+func streamGeneration(c *gin.Context, generationService *services.GenerationService, gen *services.Generation, writer streamWriter, lastEventId int64, config StreamConfig) {
+	// The generation keeps running if the client drops, so it can reconnect
+	generationService.Attach(gen)
+	defer generationService.Detach(gen)
+
+
+	c.Header("Content-Type", writer.ContentType())
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Access-Control-Allow-Headers", "Cache-Control, Last-Event-ID")
+	c.Header("X-Generation-Id", gen.Id)
+	c.Writer.Flush()
+
+
+	sub := gen.Events.Subscribe(lastEventId)
+	defer sub.Close()
+
+	relayEvents(c.Request.Context(), sub, c.Writer, writer, config)
+}
+
+
+// lastEventIdFrom reads the Last-Event-ID header, or the lastEventId query
+// parameter for clients that cannot set headers. ok is false when neither
+// was sent.
+func lastEventIdFrom(c *gin.Context) (lastEventId int64, ok bool, err error) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("lastEventId")
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+
+	lastEventId, err = strconv.ParseInt(value, 10, 64)
+	if err != nil || lastEventId < 0 {
+		return 0, false, errors.New("Last-Event-ID must be a non-negative integer")
+	}
+	return lastEventId, true, nil
+}
+
+
+// streamWriter encodes the events of a generation in one of the supported
+// stream formats. Flushing is left to the streamRelay.
+type streamWriter interface {
+	ContentType() string
+	Write(w io.Writer, event models.StreamEvent) error
+	// Heartbeat writes something clients ignore, to keep the connection open
+	Heartbeat(w io.Writer) error
+}
+
+
+// newStreamWriter picks the writer for the format query parameter: "json"
+// (the default) or "text" for clients of the original plain-text events.
+func newStreamWriter(format string, providerName string) (streamWriter, error) {
+	switch format {
+	case "", "json":
+		return &jsonStreamWriter{}, nil
+	case "text":
+		return &textStreamWriter{providerName: providerName}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q, expected \"json\" or \"text\"", format)
+	}
+}
+
+
+// jsonStreamWriter sends the versioned JSON payloads under their event IDs
+type jsonStreamWriter struct{}
+
+
+func (jsonStreamWriter) ContentType() string {
+	return "text/event-stream"
+}
+
+
+func (jsonStreamWriter) Write(w io.Writer, event models.StreamEvent) error {
+	data, err := json.Marshal(event.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+	}
+	return writeSSE(w, event.ID, event.Type, string(data))
+}
+
+
+func (jsonStreamWriter) Heartbeat(w io.Writer) error {
+	return sse.WriteComment(w, "keep-alive")
+}
+
+
+// textStreamWriter keeps the original events, where content arrives as
+// plain text in "data" events. The IDs still allow resuming.
+type textStreamWriter struct {
+	providerName string
+}
+
+
+func (textStreamWriter) ContentType() string {
+	return "text/event-stream"
+}
+
+
+func (tw textStreamWriter) Write(w io.Writer, event models.StreamEvent) error {
+	switch payload := event.Payload.(type) {
+	case models.StreamMeta:
+		if payload.GenerationId != "" {
+			if err := writeSSE(w, 0, "connection", fmt.Sprintf("Connected to %s stream", tw.providerName)); err != nil {
+				return err
+			}
+			return writeSSEJSON(w, event.ID, "generation", gin.H{"generationId": payload.GenerationId})
+		}
+		return writeSSEJSON(w, event.ID, "provider", gin.H{"provider": payload.Provider, "model": payload.Model})
+
+	case models.StreamRetrying:
+		return writeSSEJSON(w, event.ID, "retrying", payload.RetryInfo)
+
+	case models.StreamDelta:
+		return writeSSE(w, event.ID, "data", payload.Content)
+
+	case models.StreamDone:
+		if payload.FinishReason == "cancelled" {
+			return writeSSE(w, event.ID, "cancelled", "Generation cancelled")
+		}
+		return writeSSE(w, event.ID, "done", "Stream completed")
+
+	case models.StreamError:
+		return writeSSE(w, event.ID, "error", payload.Message)
+	}
+	return nil
+}
+
+
+func (textStreamWriter) Heartbeat(w io.Writer) error {
+	return sse.WriteComment(w, "keep-alive")
+}
+
+
+// ndjsonStreamWriter sends every event as one line of JSON, for clients
+// reading the response body with fetch rather than EventSource.
+type ndjsonStreamWriter struct{}
+
+
+func (ndjsonStreamWriter) ContentType() string {
+	return "application/x-ndjson"
+}
+
+
+func (ndjsonStreamWriter) Write(w io.Writer, event models.StreamEvent) error {
+	line, err := json.Marshal(models.StreamEnvelope{ID: event.ID, Event: event.Type, Data: event.Payload})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+	}
+
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+
+// Heartbeat sends an empty line, which NDJSON readers skip
+func (ndjsonStreamWriter) Heartbeat(w io.Writer) error {
+	_, err := w.Write([]byte("\n"))
+	return err
+}
+
+
+// writeSSE encodes a single event. An id of 0 is left out.
+func writeSSE(w io.Writer, id int64, eventType string, data string) error {
+	event := sse.Event{Type: eventType, Data: data}
+	if id > 0 {
+		event.ID = strconv.FormatInt(id, 10)
+	}
+	return sse.WriteEvent(w, event)
+}
+
+
+func writeSSEJSON(w io.Writer, id int64, eventType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	return writeSSE(w, id, eventType, string(data))
+}
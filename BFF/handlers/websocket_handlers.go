@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"bff/models"
+	"bff/services"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// websocketWriteTimeout bounds a single frame write, so a stalled client
+// cannot hold up the generations it follows forever
+const websocketWriteTimeout = 10 * time.Second
+
+
+type WebSocketHandlers struct {
+	messageService     *services.MessageService
+	keywordService     *services.KeywordService
+	promptService      *services.PromptService
+	modelPolicyService *services.ModelPolicyService
+	generationService  *services.GenerationService
+	allowedOrigins     []string
+}
+
+
+func NewWebSocketHandlers(messageService *services.MessageService, keywordService *services.KeywordService, promptService *services.PromptService, modelPolicyService *services.ModelPolicyService, generationService *services.GenerationService, allowedOrigins []string) *WebSocketHandlers {
+	return &WebSocketHandlers{
+		messageService:     messageService,
+		keywordService:     keywordService,
+		promptService:      promptService,
+		modelPolicyService: modelPolicyService,
+		generationService:  generationService,
+		allowedOrigins:     allowedOrigins,
+	}
+}
+
+
+// Connect upgrades the request to a WebSocket carrying a whole chat
+// session: the client sends hello, message, regenerate, cancel and attach
+// commands, and the server pushes moderation verdicts, status frames and
+// the events of every generation the session follows.
+func (h *WebSocketHandlers) Connect(c *gin.Context) {
+	server := websocket.Server{
+		Handshake: h.checkOrigin,
+		Handler: func(ws *websocket.Conn) {
+			newWebSocketSession(h, ws).serve()
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+
+// checkOrigin accepts browsers on the CORS origins and clients that send
+// no Origin at all
+func (h *WebSocketHandlers) checkOrigin(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	if !slices.Contains(h.allowedOrigins, origin) {
+		return fmt.Errorf("origin %q is not allowed", origin)
+	}
+
+	var err error
+	config.Origin, err = websocket.Origin(config, req)
+	return err
+}
+
+
+// webSocketSession is one connected client. Frames are written by the
+// read loop and by one goroutine per followed generation, so sends are
+// serialized.
+type webSocketSession struct {
+	h      *WebSocketHandlers
+	ws     *websocket.Conn
+	userId string
+	ctx    context.Context
+	cancel context.CancelFunc
+	// following tracks the goroutines streaming generations to the client
+	following sync.WaitGroup
+	sendMu    sync.Mutex
+}
+
+
+func newWebSocketSession(h *WebSocketHandlers, ws *websocket.Conn) *webSocketSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &webSocketSession{h: h, ws: ws, ctx: ctx, cancel: cancel}
+}
+
+
+func (s *webSocketSession) serve() {
+	defer s.ws.Close()
+	defer s.following.Wait()
+	defer s.cancel()
+
+	for {
+		var frame models.ClientFrame
+		if err := websocket.JSON.Receive(s.ws, &frame); err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("WebSocket session ended: %v", err)
+			}
+			return
+		}
+
+		if frame.Type != "hello" && s.userId == "" {
+			s.sendError(frame.RequestId, "Send a hello frame with your userId first")
+			continue
+		}
+
+		switch frame.Type {
+		case "hello":
+			s.hello(frame)
+		case "message":
+			s.message(frame)
+		case "regenerate":
+			s.regenerate(frame)
+		case "cancel":
+			s.cancelGeneration(frame)
+		case "attach":
+			s.attach(frame)
+		default:
+			s.sendError(frame.RequestId, fmt.Sprintf("Unknown frame type %q", frame.Type))
+		}
+	}
+}
+
+
+// hello binds the session to a user, once
+func (s *webSocketSession) hello(frame models.ClientFrame) {
+	if frame.UserId == "" {
+		s.sendError(frame.RequestId, "UserId cannot be empty")
+		return
+	}
+	if s.userId != "" && s.userId != frame.UserId {
+		s.sendError(frame.RequestId, "The session already belongs to another user")
+		return
+	}
+
+	s.userId = frame.UserId
+	s.send(models.ServerFrame{Type: "ready", RequestId: frame.RequestId})
+}
+
+
+// message runs the same checks as POST /messages, reports the moderation
+// verdict and answers approved messages
+func (s *webSocketSession) message(frame models.ClientFrame) {
+	newMessage := frame.UserMessageDTO
+	newMessage.UserId = s.userId
+
+	message, moderation, _, err := saveUserMessage(newMessage, s.h.messageService, s.h.keywordService, s.h.promptService, s.h.modelPolicyService)
+	if err != nil {
+		s.sendError(frame.RequestId, err.Error())
+		return
+	}
+
+	verdict := models.ServerFrame{
+		Type:           "moderation",
+		RequestId:      frame.RequestId,
+		MessageId:      message.MessageId,
+		ConversationId: message.ConversationId,
+		Verdict:        moderation.Verdict,
+		Action:         moderation.Action,
+	}
+	if moderation.Action != "" {
+		verdict.FoundKeywords = moderation.FoundKeywords
+		verdict.Matches = moderation.Matches
+		verdict.RedactedText = moderation.RedactedText
+	}
+	s.send(verdict)
+
+	if moderation.Verdict == models.VerdictBlocked || moderation.Verdict == models.VerdictHeld {
+		return
+	}
+
+	s.answer(frame.RequestId, &message)
+}
+
+
+// regenerate answers an earlier message again, stopping the generation
+// still running for it
+func (s *webSocketSession) regenerate(frame models.ClientFrame) {
+	message, exists := s.h.messageService.GetMessageById(frame.MessageId)
+	if !exists || message.UserId != s.userId {
+		s.sendError(frame.RequestId, "Message not found")
+		return
+	}
+
+	if previous, exists := s.h.generationService.Latest(message.MessageId); exists {
+		s.h.generationService.Cancel(previous.Id, s.userId)
+	}
+
+	s.answer(frame.RequestId, message)
+}
+
+
+func (s *webSocketSession) cancelGeneration(frame models.ClientFrame) {
+	if !s.h.generationService.Cancel(frame.GenerationId, s.userId) {
+		s.sendError(frame.RequestId, "No in-flight generation with this ID for the specified user")
+	}
+}
+
+
+// attach follows a generation started elsewhere, or resumes one this
+// client followed before reconnecting
+func (s *webSocketSession) attach(frame models.ClientFrame) {
+	gen, exists := s.h.generationService.Get(frame.GenerationId)
+	if !exists || gen.UserId != s.userId {
+		s.sendError(frame.RequestId, "No generation with this ID for the specified user")
+		return
+	}
+
+	s.follow(frame.RequestId, gen, frame.LastEventId)
+}
+
+
+func (s *webSocketSession) answer(requestId string, message *models.MessageUserTable) {
+	request, _, err := newGenerationRequest(message, s.h.messageService, s.h.promptService, s.h.modelPolicyService)
+	if err != nil {
+		s.sendError(requestId, err.Error())
+		return
+	}
+
+	gen := s.h.generationService.Start(s.userId, message.MessageId, request)
+	s.follow(requestId, gen, 0)
+}
+
+
+// follow streams the generation's events after lastEventId to the client,
+// framed by typing and idle status frames, until it ends or the session
+// closes
+func (s *webSocketSession) follow(requestId string, gen *services.Generation, lastEventId int64) {
+	s.following.Add(1)
+	s.h.generationService.Attach(gen)
+	sub := gen.Events.Subscribe(lastEventId)
+
+	go func() {
+		defer s.following.Done()
+		defer s.h.generationService.Detach(gen)
+		defer sub.Close()
+
+		s.send(models.ServerFrame{Type: "status", RequestId: requestId, GenerationId: gen.Id, MessageId: gen.MessageId, Status: "typing"})
+		for _, event := range sub.Backlog() {
+			s.sendEvent(gen, event)
+		}
+
+		for {
+			select {
+			case event, ok := <-sub.Events():
+				if !ok {
+					if err := sub.Err(); err != nil {
+						// The client can attach again after its last event
+						s.send(models.ServerFrame{Type: "error", RequestId: requestId, GenerationId: gen.Id, Error: err.Error()})
+						return
+					}
+					s.send(models.ServerFrame{Type: "status", RequestId: requestId, GenerationId: gen.Id, MessageId: gen.MessageId, Status: "idle"})
+					return
+				}
+				s.sendEvent(gen, event)
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+
+func (s *webSocketSession) sendEvent(gen *services.Generation, event models.StreamEvent) {
+	s.send(models.ServerFrame{
+		Type:         "event",
+		GenerationId: gen.Id,
+		Event:        &models.StreamEnvelope{ID: event.ID, Event: event.Type, Data: event.Payload},
+	})
+}
+
+
+func (s *webSocketSession) sendError(requestId string, message string) {
+	s.send(models.ServerFrame{Type: "error", RequestId: requestId, Error: message})
+}
+
+
+func (s *webSocketSession) send(frame models.ServerFrame) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	s.ws.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	if err := websocket.JSON.Send(s.ws, frame); err != nil {
+		// Closing the connection also ends the read loop, and with it the session
+		log.Printf("Failed to send %s frame: %v", frame.Type, err)
+		s.cancel()
+		s.ws.Close()
+	}
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"bff/models"
+	"bff/services"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+const testOrigin = "http://localhost:5173"
+
+type webSocketServer struct {
+	url      string
+	services messageServices
+}
+
+// newWebSocketServer serves a chat session on /ws. The fake provider waits
+// chunkDelay between words, so tests can act while a generation runs.
+func newWebSocketServer(t *testing.T, chunkDelay time.Duration) webSocketServer {
+	gin.SetMode(gin.TestMode)
+	s := newMessageServices(t)
+	provider := services.NewFakeProvider("")
+	provider.ChunkDelay = chunkDelay
+	generationService := services.NewGenerationService(s.messages, provider, services.GenerationConfig{})
+	h := NewWebSocketHandlers(s.messages, s.keywords, s.prompts, s.modelPolicy, generationService, []string{testOrigin})
+
+	router := gin.New()
+	router.GET("/ws", h.Connect)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return webSocketServer{url: "ws" + strings.TrimPrefix(server.URL, "http") + "/ws", services: s}
+}
+
+func (s webSocketServer) dial(t *testing.T) *websocket.Conn {
+	ws, err := websocket.Dial(s.url, "", testOrigin)
+	require.NoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func sendFrame(t *testing.T, ws *websocket.Conn, frame models.ClientFrame) {
+	require.NoError(t, websocket.JSON.Send(ws, frame))
+}
+
+func receiveFrame(t *testing.T, ws *websocket.Conn) models.ServerFrame {
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var frame models.ServerFrame
+	require.NoError(t, websocket.JSON.Receive(ws, &frame))
+	return frame
+}
+
+// receiveUntilIdle collects the event frames of a generation up to its idle
+// status frame
+func receiveUntilIdle(t *testing.T, ws *websocket.Conn) []models.ServerFrame {
+	var events []models.ServerFrame
+	for {
+		frame := receiveFrame(t, ws)
+		if frame.Type == "status" && frame.Status == "idle" {
+			return events
+		}
+		require.Equal(t, "event", frame.Type, frame.Error)
+		events = append(events, frame)
+	}
+}
+
+func hello(t *testing.T, ws *websocket.Conn, userId string) {
+	sendFrame(t, ws, models.ClientFrame{Type: "hello", UserMessageDTO: models.UserMessageDTO{UserId: userId}})
+	require.Equal(t, "ready", receiveFrame(t, ws).Type)
+}
+
+func chatMessage(requestId string, text string) models.ClientFrame {
+	return models.ClientFrame{Type: "message", RequestId: requestId, UserMessageDTO: models.UserMessageDTO{Message: text}}
+}
+
+func contentOf(events []models.ServerFrame) string {
+	content := ""
+	for _, frame := range events {
+		if frame.Event.Event == models.StreamEventDelta {
+			content += frame.Event.Data.(map[string]any)["content"].(string)
+		}
+	}
+	return content
+}
+
+func TestWebSocketSession(t *testing.T) {
+	t.Run("should reject browsers from other origins", func(t *testing.T) {
+		server := newWebSocketServer(t, 0)
+
+		_, err := websocket.Dial(server.url, "", "http://evil.example")
+		assert.Error(t, err)
+	})
+
+	t.Run("should require a hello frame first", func(t *testing.T) {
+		server := newWebSocketServer(t, 0)
+		ws := server.dial(t)
+
+		sendFrame(t, ws, chatMessage("r1", "Hi"))
+		frame := receiveFrame(t, ws)
+		assert.Equal(t, "error", frame.Type)
+		assert.Equal(t, "r1", frame.RequestId)
+		assert.Equal(t, "Send a hello frame with your userId first", frame.Error)
+		assert.Empty(t, server.services.messages.GetAllMessages())
+
+		sendFrame(t, ws, models.ClientFrame{Type: "hello"})
+		assert.Equal(t, "UserId cannot be empty", receiveFrame(t, ws).Error)
+
+		hello(t, ws, "u1")
+		hello(t, ws, "u1")
+
+		sendFrame(t, ws, models.ClientFrame{Type: "hello", UserMessageDTO: models.UserMessageDTO{UserId: "u2"}})
+		assert.Equal(t, "The session already belongs to another user", receiveFrame(t, ws).Error)
+
+		sendFrame(t, ws, models.ClientFrame{Type: "shout"})
+		assert.Equal(t, `Unknown frame type "shout"`, receiveFrame(t, ws).Error)
+	})
+
+	t.Run("should report the verdict and answer an approved message", func(t *testing.T) {
+		server := newWebSocketServer(t, 0)
+		ws := server.dial(t)
+		hello(t, ws, "u1")
+
+		sendFrame(t, ws, chatMessage("r1", "Hi there"))
+
+		verdict := receiveFrame(t, ws)
+		assert.Equal(t, "moderation", verdict.Type)
+		assert.Equal(t, "r1", verdict.RequestId)
+		assert.Equal(t, models.VerdictApproved, verdict.Verdict)
+		require.NotEmpty(t, verdict.MessageId)
+
+		typing := receiveFrame(t, ws)
+		assert.Equal(t, "status", typing.Type)
+		assert.Equal(t, "typing", typing.Status)
+		assert.Equal(t, verdict.MessageId, typing.MessageId)
+		assert.NotEmpty(t, typing.GenerationId)
+
+		events := receiveUntilIdle(t, ws)
+		assert.Equal(t, models.StreamEventMeta, events[0].Event.Event)
+		assert.Equal(t, models.StreamEventDone, events[len(events)-1].Event.Event)
+		assert.Equal(t, "You said: Hi there", contentOf(events))
+	})
+
+	t.Run("should not answer a blocked message", func(t *testing.T) {
+		server := newWebSocketServer(t, 0)
+		server.services.keywords.AddWords([]string{"spam"})
+		ws := server.dial(t)
+		hello(t, ws, "u1")
+
+		sendFrame(t, ws, chatMessage("r1", "Buy spam"))
+
+		verdict := receiveFrame(t, ws)
+		assert.Equal(t, "moderation", verdict.Type)
+		assert.Equal(t, models.VerdictBlocked, verdict.Verdict)
+		assert.Equal(t, []string{"spam"}, verdict.FoundKeywords)
+
+		// The next frame answers the next command, not the blocked message
+		hello(t, ws, "u1")
+		_, exists := server.services.messages.GetResponse(verdict.MessageId)
+		assert.False(t, exists)
+	})
+
+	t.Run("should cancel a running generation", func(t *testing.T) {
+		server := newWebSocketServer(t, 50*time.Millisecond)
+		ws := server.dial(t)
+		hello(t, ws, "u1")
+
+		sendFrame(t, ws, chatMessage("r1", "Tell me a long story about a dragon"))
+		receiveFrame(t, ws)
+		typing := receiveFrame(t, ws)
+
+		sendFrame(t, ws, models.ClientFrame{Type: "cancel", RequestId: "r2", GenerationId: "gen_unknown"})
+		sendFrame(t, ws, models.ClientFrame{Type: "cancel", GenerationId: typing.GenerationId})
+
+		var done *models.StreamEnvelope
+		for {
+			frame := receiveFrame(t, ws)
+			if frame.Type == "error" {
+				assert.Equal(t, "r2", frame.RequestId)
+				assert.Equal(t, "No in-flight generation with this ID for the specified user", frame.Error)
+				continue
+			}
+			if frame.Type == "status" {
+				assert.Equal(t, "idle", frame.Status)
+				break
+			}
+			if frame.Event.Event == models.StreamEventDone {
+				done = frame.Event
+			}
+		}
+		require.NotNil(t, done)
+		assert.Equal(t, "cancelled", done.Data.(map[string]any)["finishReason"])
+	})
+
+	t.Run("should answer a message again on regenerate", func(t *testing.T) {
+		server := newWebSocketServer(t, 0)
+		ws := server.dial(t)
+		hello(t, ws, "u1")
+
+		sendFrame(t, ws, chatMessage("r1", "Hi there"))
+		verdict := receiveFrame(t, ws)
+		first := receiveFrame(t, ws)
+		receiveUntilIdle(t, ws)
+
+		sendFrame(t, ws, models.ClientFrame{Type: "regenerate", RequestId: "r2", MessageId: verdict.MessageId})
+		typing := receiveFrame(t, ws)
+		assert.Equal(t, "r2", typing.RequestId)
+		assert.Equal(t, verdict.MessageId, typing.MessageId)
+		assert.NotEqual(t, first.GenerationId, typing.GenerationId)
+		assert.Equal(t, "You said: Hi there", contentOf(receiveUntilIdle(t, ws)))
+
+		sendFrame(t, ws, models.ClientFrame{Type: "regenerate", RequestId: "r3", MessageId: "msg_unknown"})
+		assert.Equal(t, "Message not found", receiveFrame(t, ws).Error)
+	})
+
+	t.Run("should stop following generations when the client leaves", func(t *testing.T) {
+		server := newWebSocketServer(t, 50*time.Millisecond)
+		ws := server.dial(t)
+		hello(t, ws, "u1")
+
+		sendFrame(t, ws, chatMessage("r1", "Tell me a long story about a dragon"))
+		verdict := receiveFrame(t, ws)
+		receiveFrame(t, ws)
+		require.NoError(t, ws.Close())
+
+		// Without a resume window the generation stops once its session
+		// has let go of it
+		assert.Eventually(t, func() bool {
+			response, exists := server.services.messages.GetResponse(verdict.MessageId)
+			return exists && response.FinishReason == "disconnected"
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
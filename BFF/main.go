@@ -3,8 +3,12 @@ package main
 import (
 	"bff/handlers"
 	"bff/services"
+	"bff/utils"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -16,60 +20,262 @@ func main() {
 	if err != nil {
 		log.Fatal("Error loading .env file")
 	}
-	// Get OpenAI API key from environment variable
-	openaiAPIKey := os.Getenv("OPENAI_API_KEY")
-	if openaiAPIKey == "" {
-		log.Fatal("OPENAI_API_KEY environment variable is required")
-	}
-
 	// Initialize services
 	messageService := services.NewMessageService()
 
-	keywordService, err := services.NewKeywordService()
+	// Undo disguises like "sp@m" or "s p a m" before checking for keywords
+	normalizer, err := services.NewTextNormalizer(normalizationSteps())
+	if err != nil {
+		log.Fatal("Invalid KEYWORD_NORMALIZATION:", err)
+	}
+
+	// Keywords of redact rules are masked with KEYWORD_REDACTION, either
+	// "placeholder" ("[REDACTED]") or "asterisks"
+	redactor, err := services.NewRedactor(utils.GetEnv("KEYWORD_REDACTION", services.RedactPlaceholder))
+	if err != nil {
+		log.Fatal("Invalid KEYWORD_REDACTION:", err)
+	}
+
+	keywordService, err := services.NewKeywordService(normalizer, redactor)
 	if err != nil {
 		log.Fatal("Failed to initialize keyword service:", err)
 	}
 
-	openaiService := services.NewOpenAIService(openaiAPIKey)
+	promptService, err := services.NewPromptService(utils.GetEnv("PROMPT_TEMPLATES_DIR", "prompts"))
+	if err != nil {
+		log.Fatal("Failed to load prompt templates:", err)
+	}
+
+	// Providers are tried in the order of LLM_FAILOVER_CHAIN, e.g.
+	// "openai:gpt-4o-mini,anthropic,ollama:llama3.2", or just LLM_PROVIDER
+	chain := utils.GetEnvList("LLM_FAILOVER_CHAIN")
+	if len(chain) == 0 {
+		chain = []string{utils.GetEnv("LLM_PROVIDER", "openai")}
+	}
+
+	// Models clients may pick per message, besides the provider default,
+	// which is held to its own limits or LLM_MAX_TOKENS
+	firstProvider, defaultModel, _ := strings.Cut(chain[0], ":")
+	if defaultModel == "" {
+		defaultModel = providerConfigFromEnv(firstProvider).Model
+	}
+	modelPolicyService := services.NewModelPolicyService(utils.GetEnvList("LLM_ALLOWED_MODELS"), services.ModelPolicyConfig{
+		DefaultModel: defaultModel,
+		MaxTokens:    utils.GetEnvInt("LLM_MAX_TOKENS", 4096),
+	})
+
+	timeoutConfig := services.TimeoutConfig{
+		Connect:    utils.GetEnvDuration("LLM_CONNECT_TIMEOUT", 10*time.Second),
+		FirstToken: utils.GetEnvDuration("LLM_FIRST_TOKEN_TIMEOUT", 60*time.Second),
+		Idle:       utils.GetEnvDuration("LLM_IDLE_TIMEOUT", 30*time.Second),
+		Total:      utils.GetEnvDuration("LLM_TOTAL_TIMEOUT", 10*time.Minute),
+	}
+
+	retryConfig := services.RetryConfig{
+		MaxAttempts: utils.GetEnvInt("LLM_RETRY_MAX_ATTEMPTS", 3),
+		BaseDelay:   utils.GetEnvDuration("LLM_RETRY_BASE_DELAY", 500*time.Millisecond),
+		MaxDelay:    utils.GetEnvDuration("LLM_RETRY_MAX_DELAY", 10*time.Second),
+	}
+
+	// Each provider is built once, however many chain steps and comparison
+	// models use it
+	providers := make(map[string]services.Provider)
+	providerFor := func(name string) services.Provider {
+		if provider, exists := providers[name]; exists {
+			return provider
+		}
+
+		config := providerConfigFromEnv(name)
+		config.ConnectTimeout = timeoutConfig.Connect
+		provider, err := services.NewProvider(config)
+		if err != nil {
+			log.Fatal("Failed to initialize LLM provider:", err)
+		}
+
+		// Validate provider API key, which local backends without keys can skip
+		if utils.GetEnvBool("LLM_VALIDATE_ON_STARTUP", true) {
+			if err := provider.ValidateAPIKey(); err != nil {
+				log.Fatalf("Failed to validate %s API key: %v", provider.Name(), err)
+			}
+		}
+
+		// Retry rate-limited and failing upstream calls before failing over
+		provider = services.NewRetryProvider(provider, retryConfig)
+		providers[name] = provider
+		return provider
+	}
+
+	var targets []services.FailoverTarget
+	for _, entry := range chain {
+		name, model, _ := strings.Cut(entry, ":")
+		// A provider that stalls before or during its answer fails over
+		// like one that errors
+		targets = append(targets, services.FailoverTarget{
+			Provider: services.NewTimeoutProvider(providerFor(name), timeoutConfig.ForTarget()),
+			Model:    model,
+		})
+	}
+
+	failoverProvider := services.NewFailoverProvider(targets, services.CircuitBreakerConfig{
+		FailureThreshold: utils.GetEnvInt("LLM_BREAKER_FAILURE_THRESHOLD", 5),
+		OpenTimeout:      utils.GetEnvDuration("LLM_BREAKER_OPEN_TIMEOUT", 30*time.Second),
+	})
+
+	// The total deadline applies to the generation as the client sees it,
+	// retries and failovers included
+	provider := services.NewTimeoutProvider(failoverProvider, timeoutConfig.ForChain())
+
+	// Models answering side by side in comparisons, e.g.
+	// "openai:gpt-4o-mini,openai:gpt-4o,anthropic:claude-3-5-haiku-latest",
+	// or the steps of the failover chain. They don't fail over.
+	compareModels := utils.GetEnvList("LLM_COMPARE_MODELS")
+	if len(compareModels) == 0 {
+		compareModels = chain
+	}
+	var comparisonTargets []services.ComparisonTarget
+	for _, entry := range compareModels {
+		name, model, _ := strings.Cut(entry, ":")
+		comparisonTargets = append(comparisonTargets, services.ComparisonTarget{
+			Provider: services.NewTimeoutProvider(providerFor(name), timeoutConfig),
+			Model:    model,
+		})
+	}
+	comparisonService := services.NewComparisonService(comparisonTargets)
 
-	// Validate OpenAI API key
-	if err := openaiService.ValidateAPIKey(); err != nil {
-		log.Fatal("Failed to validate OpenAI API key:", err)
+	// Generations outlive their stream, so a client that drops can resume
+	// within the window before the upstream call is stopped. Clients that
+	// fall too far behind are dropped and resume the same way.
+	generationService := services.NewGenerationService(messageService, provider, services.GenerationConfig{
+		ResumeWindow:     utils.GetEnvDuration("STREAM_RESUME_WINDOW", 30*time.Second),
+		Retention:        utils.GetEnvDuration("GENERATION_RETENTION", time.Hour),
+		SubscriberBuffer: utils.GetEnvInt("STREAM_SUBSCRIBER_BUFFER", services.DefaultSubscriberBuffer),
+	})
+
+	// Deltas are flushed in small batches rather than one by one, and silent
+	// streams get keep-alives so proxies don't drop them
+	streamConfig := handlers.StreamConfig{
+		HeartbeatInterval: utils.GetEnvDuration("STREAM_HEARTBEAT_INTERVAL", 15*time.Second),
+		CoalesceWindow:    utils.GetEnvDuration("STREAM_COALESCE_WINDOW", 25*time.Millisecond),
+		CoalesceBytes:     utils.GetEnvInt("STREAM_COALESCE_BYTES", 4096),
 	}
 
 	// Initialize handlers
-	messageHandlers := handlers.NewMessageHandlers(messageService, keywordService)
+	messageHandlers := handlers.NewMessageHandlers(messageService, keywordService, promptService, modelPolicyService)
 	keywordHandlers := handlers.NewKeywordHandlers(keywordService)
-	sseHandlers := handlers.NewSSEHandlers(messageService, openaiService)
+	promptHandlers := handlers.NewPromptHandlers(promptService)
+	modelHandlers := handlers.NewModelHandlers(modelPolicyService)
+	providerHandlers := handlers.NewProviderHandlers(failoverProvider)
+	generationHandlers := handlers.NewGenerationHandlers(messageService, promptService, modelPolicyService, generationService, provider, streamConfig)
+	chatHandlers := handlers.NewChatHandlers(messageService, keywordService, promptService, modelPolicyService, generationService, streamConfig)
+	sseHandlers := handlers.NewSSEHandlers(messageService, promptService, modelPolicyService, generationService, provider, streamConfig)
+	comparisonHandlers := handlers.NewComparisonHandlers(messageService, promptService, modelPolicyService, comparisonService, streamConfig)
 
 	// Setup router
 	router := gin.Default()
 
+	allowedOrigins := []string{"http://localhost:8080"}
+	webSocketHandlers := handlers.NewWebSocketHandlers(messageService, keywordService, promptService, modelPolicyService, generationService, allowedOrigins)
+
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:8080"},
+		AllowOrigins:     allowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Last-Event-ID"},
+		ExposeHeaders:    []string{"Content-Length", "X-Generation-Id", "X-Message-Id", "X-Conversation-Id", "X-Moderation-Verdict"},
 		AllowCredentials: true,
 	}))
 
 	// Message routes
 	router.POST("/messages", messageHandlers.PostMessage)
 	router.GET("/messages", messageHandlers.GetMessages)
+	router.GET("/held-messages", messageHandlers.GetHeldMessages)
+	router.POST("/held-messages/:id/approve", messageHandlers.ApproveMessage)
+	router.POST("/held-messages/:id/reject", messageHandlers.RejectMessage)
 	router.POST("/char-limit", messageHandlers.PostCharLimit)
 	router.GET("/char-limit", messageHandlers.GetCharLimit)
 
 	// Keyword routes
 	router.POST("/lemmatized-keywords", keywordHandlers.PostKeywords)
 	router.GET("/lemmatized-keywords", keywordHandlers.GetKeywords)
+	router.GET("/keyword-rules", keywordHandlers.GetKeywordRules)
+	router.POST("/moderate", keywordHandlers.PostModerate)
+
+	// Prompt template routes
+	router.GET("/prompts", promptHandlers.GetPrompts)
+	router.POST("/prompts/reload", promptHandlers.ReloadPrompts)
+	router.GET("/users/:userId/prompt", promptHandlers.GetUserPrompt)
+	router.PUT("/users/:userId/prompt", promptHandlers.PutUserPrompt)
+
+	// Model allowlist routes
+	router.GET("/allowed-models", modelHandlers.GetAllowedModels)
+	router.POST("/allowed-models", modelHandlers.PostAllowedModel)
+	router.DELETE("/allowed-models/:model", modelHandlers.DeleteAllowedModel)
+
+	// Provider status routes
+	router.GET("/providers", providerHandlers.GetProviders)
 
 	// SSE/Streaming routes
 	router.GET("/ask-chatgpt", sseHandlers.StreamCompletion)
+	router.POST("/chat/stream", chatHandlers.PostChatStream)
+	router.GET("/ws", webSocketHandlers.Connect)
+
+	// Model comparison routes
+	router.GET("/compare", comparisonHandlers.StreamComparison)
+	router.GET("/compare/models", comparisonHandlers.GetComparisonModels)
+
+	// Background generation routes
+	router.POST("/generations", generationHandlers.PostGeneration)
+	router.GET("/generations/:id", generationHandlers.GetGeneration)
+	router.GET("/generations/:id/events", generationHandlers.StreamGeneration)
+	router.POST("/generations/:id/cancel", generationHandlers.CancelGeneration)
 
 	// Start server
 	log.Println("Server starting on :8081")
-	log.Println("Make sure to set OPENAI_API_KEY environment variable")
+	log.Println("Using LLM provider:", provider.Name())
 	if err := router.Run(":8081"); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+// providerConfigFromEnv reads the settings of the named provider from
+// <NAME>_API_KEY, <NAME>_BASE_URL and <NAME>_MODEL, e.g. ANTHROPIC_API_KEY.
+// LLM_MODEL only stands in for the model of LLM_PROVIDER, since a model
+// name rarely means anything to another provider.
+func providerConfigFromEnv(name string) services.ProviderConfig {
+	prefix := strings.ToUpper(name)
+	model := os.Getenv(prefix + "_MODEL")
+	if model == "" && name == utils.GetEnv("LLM_PROVIDER", "openai") {
+		model = os.Getenv("LLM_MODEL")
+	}
+	return services.ProviderConfig{
+		Provider: name,
+		APIKey:   os.Getenv(prefix + "_API_KEY"),
+		BaseURL:  os.Getenv(prefix + "_BASE_URL"),
+		Model:    model,
+		// Unset leaves the choice to the provider
+		StreamUsage: envBoolPointer("LLM_STREAM_USAGE"),
+	}
+}
+
+// envBoolPointer parses the environment variable as a boolean, or returns
+// nil when it is unset or invalid
+func envBoolPointer(key string) *bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return nil
+	}
+	return &value
+}
+
+// normalizationSteps reads KEYWORD_NORMALIZATION, which lists the steps to
+// run, "none" for none, or defaults to all of them
+func normalizationSteps() []string {
+	steps := utils.GetEnvList("KEYWORD_NORMALIZATION")
+	switch {
+	case len(steps) == 0:
+		return services.NormalizationSteps
+	case len(steps) == 1 && steps[0] == "none":
+		return nil
+	default:
+		return steps
+	}
+}
@@ -0,0 +1,52 @@
+package models
+
+// AnthropicRequest represents the request structure for Anthropic's Messages API
+type AnthropicRequest struct {
+	Model         string    `json:"model"`
+	System        string    `json:"system,omitempty"`
+	Messages      []Message `json:"messages"`
+	MaxTokens     int       `json:"max_tokens"`
+	Stream        bool      `json:"stream"`
+	Temperature   *float64  `json:"temperature,omitempty"`
+	TopP          *float64  `json:"top_p,omitempty"`
+	StopSequences []string  `json:"stop_sequences,omitempty"`
+}
+
+// AnthropicResponse represents a non-streaming response from the Messages API
+type AnthropicResponse struct {
+	ID         string `json:"id"`
+	Model      string `json:"model"`
+	StopReason string `json:"stop_reason"`
+	Content    []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Usage AnthropicUsage `json:"usage"`
+}
+
+// AnthropicUsage is the token usage of a message. In a stream the input
+// tokens come with message_start and the output tokens with message_delta.
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// AnthropicStreamEvent represents one event of a streaming Messages API
+// response. Only the fields of the event types we consume are mapped.
+type AnthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Model string         `json:"model"`
+		Usage AnthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage AnthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
@@ -0,0 +1,85 @@
+package models
+
+// Message represents a chat message
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// GenerationParams are the optional sampling settings a client can pass
+// with a message. Nil fields leave the provider's default in place.
+type GenerationParams struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"topP,omitempty"`
+	MaxTokens        *int     `json:"maxTokens,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	PresencePenalty  *float64 `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequencyPenalty,omitempty"`
+}
+
+// ModelLimits is an admin-managed allowlist entry. Zero limits fall back to
+// the general bounds checked by ModelPolicyService.
+type ModelLimits struct {
+	Model          string  `json:"model"`
+	MaxTokens      int     `json:"maxTokens"`
+	MaxTemperature float64 `json:"maxTemperature"`
+}
+
+// ChatRequest is the provider-neutral input for a chat completion
+type ChatRequest struct {
+	Model    string
+	Messages []Message
+	Params   GenerationParams
+}
+
+// ChatResponse is the provider-neutral result of a non-streaming completion
+type ChatResponse struct {
+	Content      string
+	FinishReason string
+	Model        string
+	Provider     string
+	Usage        *Usage
+}
+
+// Usage counts the tokens a completion consumed, as reported by the provider
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// NewUsage fills in the total of a prompt and completion token count
+func NewUsage(promptTokens, completionTokens int) *Usage {
+	return &Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+	}
+}
+
+// StreamChunk is a single piece of a streamed completion. A chunk with
+// Retry set carries no content and announces a retry of the upstream call.
+// Usage is only set on the chunk that reports it, usually the last one.
+type StreamChunk struct {
+	Content      string
+	FinishReason string
+	Model        string
+	Provider     string
+	Usage        *Usage
+	Retry        *RetryInfo
+}
+
+// RetryInfo describes an upstream retry that is about to happen
+type RetryInfo struct {
+	Attempt     int    `json:"attempt"`
+	MaxAttempts int    `json:"maxAttempts"`
+	DelayMs     int64  `json:"delayMs"`
+	Reason      string `json:"reason"`
+}
+
+// ProviderStatus reports the circuit breaker state of a configured provider
+type ProviderStatus struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+}
@@ -0,0 +1,46 @@
+package models
+
+// Types of the events of a comparison stream besides meta and delta
+const (
+	ComparisonEventResult  = "result"
+	ComparisonEventSummary = "summary"
+)
+
+// ComparisonMeta is the payload of the "meta" event opening a comparison
+// stream, listing the models in the order of the summary
+type ComparisonMeta struct {
+	Version   int      `json:"v"`
+	MessageId string   `json:"messageId"`
+	Models    []string `json:"models"`
+}
+
+// ComparisonDelta is the payload of a "delta" event of a comparison
+// stream. Index counts the deltas of each model separately.
+type ComparisonDelta struct {
+	Version int    `json:"v"`
+	Model   string `json:"model"`
+	Index   int    `json:"index"`
+	Content string `json:"content"`
+}
+
+// ComparisonResult reports how one model of a comparison did. It is sent
+// in a "result" event when the model finishes, and again in the summary.
+type ComparisonResult struct {
+	Version         int     `json:"v"`
+	Model           string  `json:"model"`
+	Provider        string  `json:"provider"`
+	FinishReason    string  `json:"finishReason"`
+	Usage           *Usage  `json:"usage,omitempty"`
+	LatencyMs       int64   `json:"latencyMs"`
+	DurationMs      int64   `json:"durationMs"`
+	TokensPerSecond float64 `json:"tokensPerSecond,omitempty"`
+	ErrorCode       string  `json:"errorCode,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// ComparisonSummary is the payload of the "summary" event that ends a
+// comparison stream once every model has finished
+type ComparisonSummary struct {
+	Version int                `json:"v"`
+	Results []ComparisonResult `json:"results"`
+}
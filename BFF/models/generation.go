@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// CancelGenerationDTO identifies the user asking to cancel a generation
+type CancelGenerationDTO struct {
+	UserId string `json:"userId"`
+}
+
+// StartGenerationDTO asks for a background generation answering a message
+type StartGenerationDTO struct {
+	UserId    string `json:"userId"`
+	MessageId string `json:"messageId"`
+}
+
+// GenerationStatus is a snapshot of a generation for polling clients.
+// LastEventId lets them attach to the event stream where the snapshot ends.
+type GenerationStatus struct {
+	GenerationId string    `json:"generationId"`
+	MessageId    string    `json:"messageId"`
+	Status       string    `json:"status"`
+	Content      string    `json:"content"`
+	FinishReason string    `json:"finishReason,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	Provider     string    `json:"provider,omitempty"`
+	Usage        *Usage    `json:"usage,omitempty"`
+	ErrorCode    string    `json:"errorCode,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	LastEventId  int64     `json:"lastEventId"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
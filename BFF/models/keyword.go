@@ -1,6 +1,105 @@
 package models
 
-// KeywordRequest represents the request structure for adding keywords
+// KeywordRequest represents the request structure for adding keywords.
+// Category, Severity and Action apply to all of them and are optional.
 type KeywordRequest struct {
 	Keywords []string `json:"keywords"`
+	Category string   `json:"category"`
+	Severity string   `json:"severity"`
+	Action   string   `json:"action"`
+}
+
+// Severities of keyword rules, from the lowest
+const (
+	KeywordSeverityLow    = "low"
+	KeywordSeverityMedium = "medium"
+	KeywordSeverityHigh   = "high"
+)
+
+// Actions of keyword rules, from the mildest. A message matching several
+// rules gets the strictest of their actions.
+const (
+	// KeywordActionWarn answers the message and warns the user
+	KeywordActionWarn = "warn"
+	// KeywordActionFlag answers the message but flags it
+	KeywordActionFlag = "flag"
+	// KeywordActionRedact answers the message with the keywords masked
+	KeywordActionRedact = "redact"
+	// KeywordActionReview holds the message until a moderator approves it
+	KeywordActionReview = "review"
+	// KeywordActionBlock rejects the message
+	KeywordActionBlock = "block"
+)
+
+// Verdicts on a message, following from the action taken
+const (
+	VerdictApproved = "approved"
+	VerdictWarned   = "warned"
+	VerdictFlagged  = "flagged"
+	VerdictRedacted = "redacted"
+	VerdictHeld     = "held"
+	VerdictBlocked  = "blocked"
+)
+
+// KeywordRule is a forbidden keyword with what to do about messages
+// containing it
+type KeywordRule struct {
+	Id string `json:"id"`
+	// Keyword is the lemmatized keyword or phrase
+	Keyword string `json:"keyword"`
+	// Category groups rules, e.g. "hate", "pii" or "competitor"
+	Category string `json:"category"`
+	Severity string `json:"severity"`
+	Action   string `json:"action"`
+}
+
+// KeywordMatch is an occurrence of a forbidden keyword in a text
+type KeywordMatch struct {
+	RuleId   string `json:"ruleId"`
+	Category string `json:"category"`
+	Severity string `json:"severity"`
+	Action   string `json:"action"`
+	// Keyword is the lemmatized keyword or phrase that matched
+	Keyword string `json:"keyword"`
+	// Text is what the text says there, e.g. "sp@m" for the keyword "spam"
+	Text string `json:"text"`
+	// Start and End are byte offsets into the text, RuneStart and RuneEnd
+	// count Unicode code points instead
+	Start     int `json:"start"`
+	End       int `json:"end"`
+	RuneStart int `json:"runeStart"`
+	RuneEnd   int `json:"runeEnd"`
+	// Normalization lists the normalization steps that changed the
+	// matched words
+	Normalization []string       `json:"normalization"`
+	Tokens        []MatchedToken `json:"tokens"`
+}
+
+// MatchedToken is one word of a KeywordMatch, as written, after
+// normalization and as lemma
+type MatchedToken struct {
+	Text       string `json:"text"`
+	Normalized string `json:"normalized"`
+	Lemma      string `json:"lemma"`
+}
+
+// ModerationRequest asks for a text to be checked without posting it
+type ModerationRequest struct {
+	Text string `json:"text"`
+}
+
+// ModerationResult is the policy decision on a text, following from the
+// keyword rules it matches
+type ModerationResult struct {
+	Verdict string `json:"verdict"`
+	// Action and Severity are the strictest of the matched rules, and are
+	// empty when nothing matched
+	Action        string         `json:"action,omitempty"`
+	Severity      string         `json:"severity,omitempty"`
+	Categories    []string       `json:"categories"`
+	FoundKeywords []string       `json:"foundKeywords"`
+	Matches       []KeywordMatch `json:"matches"`
+	// RedactedText is the text with the keywords of redact rules masked,
+	// when any matched
+	RedactedText string `json:"redactedText,omitempty"`
 }
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // UserMessage represents a user message in the system
 type CharLimitDTO struct {
 	CharLimit int16 `json:"charLimit"`
@@ -7,13 +9,57 @@ type CharLimitDTO struct {
 
 // UserMessage represents a user message in the system
 type UserMessageDTO struct {
-	Message string `json:"message"`
-	UserId  string `json:"userId"`
+	Message        string           `json:"message"`
+	UserId         string           `json:"userId"`
+	ConversationId string           `json:"conversationId"`
+	Prompt         PromptOptions    `json:"prompt"`
+	Model          string           `json:"model"`
+	Params         GenerationParams `json:"params"`
 }
 
+// Reviews of a held message by a moderator
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
 type MessageUserTable struct {
 	MessageId      string
+	ConversationId string
 	UserId         string
 	Flagged        bool
+	// Moderation is the action the keyword rules took on the message, empty
+	// when none matched
+	Moderation string
+	// Review is where a message held for review stands with the
+	// moderators, empty for messages that were not held
+	Review         string
 	MessageContent string
+	// RedactedContent is MessageContent with keywords masked, which the
+	// model gets instead. It is empty when nothing was redacted.
+	RedactedContent string
+	Prompt          PromptOptions
+	Model           string
+	Params          GenerationParams
+}
+
+// AssistantResponse is the model's reply to a stored user message
+type AssistantResponse struct {
+	MessageId    string    `json:"messageId"`
+	Content      string    `json:"content"`
+	FinishReason string    `json:"finishReason"`
+	Model        string    `json:"model"`
+	Provider     string    `json:"provider"`
+	StartedAt    time.Time `json:"startedAt"`
+	CompletedAt  time.Time `json:"completedAt"`
+	LatencyMs    int64     `json:"latencyMs"`
+	DurationMs   int64     `json:"durationMs"`
+	Usage        *Usage    `json:"usage,omitempty"`
+}
+
+// MessagePair couples a user message with the assistant's answer, if any
+type MessagePair struct {
+	Question MessageUserTable   `json:"question"`
+	Answer   *AssistantResponse `json:"answer"`
 }
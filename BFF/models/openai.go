@@ -1,16 +1,31 @@
 package models
 
-// Message represents a chat message
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
 // OpenAIRequest represents the request structure for OpenAI API
 type OpenAIRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-	Stream   bool      `json:"stream"`
+	Model            string    `json:"model"`
+	Messages         []Message `json:"messages"`
+	Stream           bool      `json:"stream"`
+	Temperature      *float64  `json:"temperature,omitempty"`
+	TopP             *float64  `json:"top_p,omitempty"`
+	MaxTokens        *int      `json:"max_tokens,omitempty"`
+	Stop             []string  `json:"stop,omitempty"`
+	Seed             *int      `json:"seed,omitempty"`
+	PresencePenalty  *float64  `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64  `json:"frequency_penalty,omitempty"`
+	// StreamOptions asks for a final chunk carrying the token usage
+	StreamOptions *OpenAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+// OpenAIStreamOptions are the options of a streaming request
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// OpenAIUsage is the token usage of a completion
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 // Choice represents a choice in the OpenAI response
@@ -30,4 +45,29 @@ type OpenAIStreamResponse struct {
 	Created int64    `json:"created"`
 	Model   string   `json:"model"`
 	Choices []Choice `json:"choices"`
+	// Usage is only set on the last chunk, which has no choices
+	Usage *OpenAIUsage `json:"usage,omitempty"`
+	// Error is set when the server fails after the stream has started
+	Error *OpenAIError `json:"error,omitempty"`
+}
+
+// OpenAIError is the error object OpenAI-compatible servers send mid-stream
+type OpenAIError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    any    `json:"code"`
+}
+
+// OpenAIResponse represents a non-streaming response from OpenAI
+type OpenAIResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index        int     `json:"index"`
+		Message      Message `json:"message"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *OpenAIUsage `json:"usage,omitempty"`
 }
@@ -0,0 +1,15 @@
+package models
+
+// PromptOptions selects the system prompt template for a message and fills
+// in its variables. Every field is optional.
+type PromptOptions struct {
+	Template string `json:"template"`
+	UserName string `json:"userName"`
+	Locale   string `json:"locale"`
+	Context  string `json:"context"`
+}
+
+// PromptTemplateDTO is used to assign a default template to a user
+type PromptTemplateDTO struct {
+	Template string `json:"template"`
+}
@@ -0,0 +1,74 @@
+package models
+
+// StreamEventVersion is sent as "v" in every structured stream event and
+// is bumped when a payload changes in a way older clients cannot handle.
+const StreamEventVersion = 1
+
+// Types of the events a generation produces
+const (
+	StreamEventMeta     = "meta"
+	StreamEventRetrying = "retrying"
+	StreamEventDelta    = "delta"
+	StreamEventDone     = "done"
+	StreamEventError    = "error"
+)
+
+// StreamEvent is one event of a generation. IDs count from 1 within the
+// generation, and Payload is the Stream* type matching Type.
+type StreamEvent struct {
+	ID      int64
+	Type    string
+	Payload any
+}
+
+// StreamEnvelope carries a StreamEvent over transports without their own
+// event framing, such as NDJSON lines
+type StreamEnvelope struct {
+	ID    int64  `json:"id"`
+	Event string `json:"event"`
+	Data  any    `json:"data"`
+}
+
+// StreamMeta is the payload of a "meta" event. It is sent once when the
+// stream opens, with the generation and message IDs, and again with the
+// provider and model whenever a provider of the failover chain answers.
+type StreamMeta struct {
+	Version      int    `json:"v"`
+	GenerationId string `json:"generationId,omitempty"`
+	MessageId    string `json:"messageId,omitempty"`
+	Provider     string `json:"provider,omitempty"`
+	Model        string `json:"model,omitempty"`
+}
+
+// StreamRetrying is the payload of a "retrying" event
+type StreamRetrying struct {
+	Version int `json:"v"`
+	RetryInfo
+}
+
+// StreamDelta is the payload of a "delta" event. Index counts the deltas
+// of the stream from 0, so clients can detect gaps and reordering.
+type StreamDelta struct {
+	Version int    `json:"v"`
+	Index   int    `json:"index"`
+	Content string `json:"content"`
+}
+
+// StreamDone is the payload of the "done" event that ends every stream
+// that did not fail, including cancelled ones
+type StreamDone struct {
+	Version      int    `json:"v"`
+	FinishReason string `json:"finishReason"`
+	Model        string `json:"model,omitempty"`
+	Provider     string `json:"provider,omitempty"`
+	Usage        *Usage `json:"usage,omitempty"`
+	LatencyMs    int64  `json:"latencyMs"`
+	DurationMs   int64  `json:"durationMs"`
+}
+
+// StreamError is the payload of an "error" event
+type StreamError struct {
+	Version int    `json:"v"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,31 @@
+package models
+
+// ClientFrame is a command sent by a WebSocket client. A "message" frame
+// carries the same fields as a posted message.
+type ClientFrame struct {
+	Type string `json:"type"`
+	// RequestId is echoed in the frames answering this command
+	RequestId    string `json:"requestId,omitempty"`
+	GenerationId string `json:"generationId,omitempty"`
+	MessageId    string `json:"messageId,omitempty"`
+	LastEventId  int64  `json:"lastEventId,omitempty"`
+	UserMessageDTO
+}
+
+// ServerFrame is pushed to a WebSocket client. Which fields are set
+// depends on Type.
+type ServerFrame struct {
+	Type           string          `json:"type"`
+	RequestId      string          `json:"requestId,omitempty"`
+	GenerationId   string          `json:"generationId,omitempty"`
+	MessageId      string          `json:"messageId,omitempty"`
+	ConversationId string          `json:"conversationId,omitempty"`
+	Verdict        string          `json:"verdict,omitempty"`
+	Action         string          `json:"action,omitempty"`
+	FoundKeywords  []string        `json:"foundKeywords,omitempty"`
+	Matches        []KeywordMatch  `json:"matches,omitempty"`
+	RedactedText   string          `json:"redactedText,omitempty"`
+	Status         string          `json:"status,omitempty"`
+	Event          *StreamEnvelope `json:"event,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"bff/models"
+	"bff/sse"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultAnthropicBaseURL   = "https://api.anthropic.com/v1"
+	defaultAnthropicModel     = "claude-3-5-haiku-latest"
+	defaultAnthropicMaxTokens = 1024
+	anthropicAPIVersion       = "2023-06-01"
+)
+
+// AnthropicService talks to Anthropic's Messages API and maps its stream
+// onto the same chunks the OpenAI provider produces.
+type AnthropicService struct {
+	apiKey  string
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+func NewAnthropicService(config ProviderConfig) *AnthropicService {
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = defaultAnthropicBaseURL
+	}
+	model := config.Model
+	if model == "" {
+		model = defaultAnthropicModel
+	}
+
+	return &AnthropicService{
+		apiKey:  config.APIKey,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		model:   model,
+		client:  newHTTPClient(config.ConnectTimeout),
+	}
+}
+
+func (s *AnthropicService) Name() string {
+	return "anthropic"
+}
+
+func (s *AnthropicService) StreamCompletion(ctx context.Context, request models.ChatRequest, responseChan chan<- models.StreamChunk, errorChan chan<- error) {
+	defer close(responseChan)
+	defer close(errorChan)
+
+	req, err := s.newMessagesRequest(ctx, request, true)
+	if err != nil {
+		errorChan <- err
+		return
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		errorChan <- newConnectionError(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errorChan <- newStatusError("Anthropic", resp)
+		return
+	}
+
+	var model string
+	var inputTokens int
+	reader := sse.NewReader(resp.Body)
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			errorChan <- fmt.Errorf("error reading stream: %w", err)
+			return
+		}
+
+		// The event type is repeated inside the JSON payload, which is what is matched on
+		var streamEvent models.AnthropicStreamEvent
+		if err := event.Decode(&streamEvent); err != nil {
+			errorChan <- err
+			return
+		}
+
+		switch streamEvent.Type {
+		case "message_start":
+			model = streamEvent.Message.Model
+			inputTokens = streamEvent.Message.Usage.InputTokens
+
+		case "content_block_delta":
+			if streamEvent.Delta.Type == "text_delta" && streamEvent.Delta.Text != "" {
+				if !sendChunk(ctx, responseChan, models.StreamChunk{Content: streamEvent.Delta.Text, Model: model}) {
+					errorChan <- ctx.Err()
+					return
+				}
+			}
+
+		case "message_delta":
+			if streamEvent.Delta.StopReason != "" {
+				chunk := models.StreamChunk{
+					FinishReason: anthropicFinishReason(streamEvent.Delta.StopReason),
+					Model:        model,
+					Usage:        models.NewUsage(inputTokens, streamEvent.Usage.OutputTokens),
+				}
+				if !sendChunk(ctx, responseChan, chunk) {
+					errorChan <- ctx.Err()
+					return
+				}
+			}
+
+		case "message_stop":
+			return
+
+		case "error":
+			// Overload and internal errors can arrive as events after a 200
+			errorChan <- &UpstreamError{
+				Message:   fmt.Sprintf("Anthropic stream error: %s - %s", streamEvent.Error.Type, streamEvent.Error.Message),
+				Retryable: streamEvent.Error.Type == "overloaded_error" || streamEvent.Error.Type == "api_error",
+			}
+			return
+		}
+	}
+}
+
+func (s *AnthropicService) Complete(ctx context.Context, request models.ChatRequest) (*models.ChatResponse, error) {
+	req, err := s.newMessagesRequest(ctx, request, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, newConnectionError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError("Anthropic", resp)
+	}
+
+	var message models.AnthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	var content strings.Builder
+	for _, block := range message.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+
+	return &models.ChatResponse{
+		Content:      content.String(),
+		FinishReason: anthropicFinishReason(message.StopReason),
+		Model:        message.Model,
+		Usage:        models.NewUsage(message.Usage.InputTokens, message.Usage.OutputTokens),
+	}, nil
+}
+
+func (s *AnthropicService) ValidateAPIKey() error {
+	ctx, cancel := context.WithTimeout(context.Background(), validateAPIKeyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL+"/models", nil)
+	if err != nil {
+		return err
+	}
+	s.setHeaders(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errors.New("invalid Anthropic API key")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Anthropic API error: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// newMessagesRequest builds the /messages call. System messages are lifted
+// out of the conversation into the top-level system field the API expects.
+func (s *AnthropicService) newMessagesRequest(ctx context.Context, request models.ChatRequest, stream bool) (*http.Request, error) {
+	model := request.Model
+	if model == "" {
+		model = s.model
+	}
+
+	// The Messages API has no seed or penalty settings, so those are dropped
+	requestBody := models.AnthropicRequest{
+		Model:         model,
+		MaxTokens:     defaultAnthropicMaxTokens,
+		Stream:        stream,
+		Temperature:   request.Params.Temperature,
+		TopP:          request.Params.TopP,
+		StopSequences: request.Params.Stop,
+	}
+	if request.Params.MaxTokens != nil {
+		requestBody.MaxTokens = *request.Params.MaxTokens
+	}
+
+	var system []string
+	for _, message := range request.Messages {
+		if message.Role == "system" {
+			system = append(system, message.Content)
+			continue
+		}
+		requestBody.Messages = append(requestBody.Messages, message)
+	}
+	requestBody.System = strings.Join(system, "\n\n")
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.baseURL+"/messages", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	s.setHeaders(req)
+
+	return req, nil
+}
+
+func (s *AnthropicService) setHeaders(req *http.Request) {
+	req.Header.Set("x-api-key", s.apiKey)
+	req.Header.Set("anthropic-version", anthropicAPIVersion)
+}
+
+// anthropicFinishReason translates Anthropic stop reasons into the
+// OpenAI-style finish reasons the rest of the BFF reports.
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	default:
+		return stopReason
+	}
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitBreakerConfig controls when a CircuitBreaker opens and how long it
+// stays open before letting a probe through
+type CircuitBreakerConfig struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+// CircuitBreaker stops calls to a provider after FailureThreshold
+// consecutive failures. Once OpenTimeout has passed a single probe call is
+// allowed through; its outcome closes the breaker or opens it again.
+type CircuitBreaker struct {
+	config   CircuitBreakerConfig
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	if config.FailureThreshold < 1 {
+		config.FailureThreshold = 1
+	}
+	return &CircuitBreaker{
+		config: config,
+		state:  CircuitClosed,
+		now:    time.Now,
+	}
+}
+
+// Allow reports whether a call may go ahead. Every allowed call must be
+// followed by Success, Failure or Release.
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.config.OpenTimeout {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		// Only one probe at a time
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = CircuitClosed
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == CircuitHalfOpen || b.failures >= b.config.FailureThreshold {
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Release ends an allowed call whose outcome is unknown, e.g. because the
+// caller cancelled it, without counting it either way.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"bff/models"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ComparisonTarget is one model taking part in comparisons. An empty Model
+// uses the provider's default.
+type ComparisonTarget struct {
+	Provider Provider
+	Model    string
+}
+
+// Label names the target in comparison events, e.g. "openai:gpt-4o-mini"
+func (t ComparisonTarget) Label() string {
+	if t.Model == "" {
+		return t.Provider.Name()
+	}
+	return t.Provider.Name() + ":" + t.Model
+}
+
+// ComparisonService sends one request to several models at once, so their
+// answers can be compared side by side.
+type ComparisonService struct {
+	targets []ComparisonTarget
+}
+
+func NewComparisonService(targets []ComparisonTarget) *ComparisonService {
+	return &ComparisonService{targets: targets}
+}
+
+// Select returns the targets with the given labels, or all of them when
+// no labels are given
+func (s *ComparisonService) Select(labels []string) ([]ComparisonTarget, error) {
+	if len(s.targets) == 0 {
+		return nil, errors.New("no comparison models are configured")
+	}
+	if len(labels) == 0 {
+		return s.targets, nil
+	}
+
+	var selected []ComparisonTarget
+	for _, label := range labels {
+		found := false
+		for _, target := range s.targets {
+			if target.Label() == label {
+				selected = append(selected, target)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("model %q is not configured for comparisons", label)
+		}
+	}
+	return selected, nil
+}
+
+// Labels returns the labels of all configured targets
+func (s *ComparisonService) Labels() []string {
+	labels := make([]string, 0, len(s.targets))
+	for _, target := range s.targets {
+		labels = append(labels, target.Label())
+	}
+	return labels
+}
+
+// Compare streams the request from every target at the same time into
+// events: a meta event, the deltas of all targets tagged with their label,
+// a result event per target as it finishes, and a summary once all have.
+// The log is closed at the end. Cancelling ctx stops every target.
+func (s *ComparisonService) Compare(ctx context.Context, messageId string, request models.ChatRequest, targets []ComparisonTarget, events *EventLog) {
+	defer events.Close()
+
+	labels := make([]string, 0, len(targets))
+	for _, target := range targets {
+		labels = append(labels, target.Label())
+	}
+	events.Append(models.StreamEventMeta, models.ComparisonMeta{
+		Version:   models.StreamEventVersion,
+		MessageId: messageId,
+		Models:    labels,
+	})
+
+	results := make([]models.ComparisonResult, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = s.run(ctx, target, request, events)
+			events.Append(models.ComparisonEventResult, results[i])
+		}()
+	}
+	wg.Wait()
+
+	events.Append(models.ComparisonEventSummary, models.ComparisonSummary{
+		Version: models.StreamEventVersion,
+		Results: results,
+	})
+}
+
+// run streams one target's answer into events and measures it
+func (s *ComparisonService) run(ctx context.Context, target ComparisonTarget, request models.ChatRequest, events *EventLog) models.ComparisonResult {
+	label := target.Label()
+	// The model picked for the message belongs to its own provider, so a
+	// target without a model gets its provider's default
+	request.Model = target.Model
+
+	responseChan := make(chan models.StreamChunk, 100)
+	errorChan := make(chan error, 1)
+	go target.Provider.StreamCompletion(ctx, request, responseChan, errorChan)
+
+	recorder := NewResponseRecorder("")
+	deltas := 0
+	for chunk := range responseChan {
+		if chunk.Retry != nil {
+			continue
+		}
+
+		recorder.Add(chunk)
+		if chunk.Content == "" {
+			continue
+		}
+		events.Append(models.StreamEventDelta, models.ComparisonDelta{
+			Version: models.StreamEventVersion,
+			Model:   label,
+			Index:   deltas,
+			Content: chunk.Content,
+		})
+		deltas++
+	}
+	// The provider closes errorChan before responseChan, so a nil error
+	// here means the stream completed
+	err := <-errorChan
+
+	finishReason := "stop"
+	switch {
+	case err != nil && ctx.Err() != nil:
+		finishReason = "cancelled"
+	case err != nil:
+		finishReason = "error"
+	}
+	response := recorder.Finish(finishReason)
+
+	result := models.ComparisonResult{
+		Version:      models.StreamEventVersion,
+		Model:        label,
+		Provider:     target.Provider.Name(),
+		FinishReason: response.FinishReason,
+		Usage:        response.Usage,
+		LatencyMs:    response.LatencyMs,
+		DurationMs:   response.DurationMs,
+	}
+	if err != nil {
+		result.FinishReason = finishReason
+		result.ErrorCode = ErrorCode(err)
+		result.Error = err.Error()
+	}
+	if response.Usage != nil && response.DurationMs > 0 {
+		result.TokensPerSecond = float64(response.Usage.CompletionTokens) * 1000 / float64(response.DurationMs)
+	}
+	return result
+}
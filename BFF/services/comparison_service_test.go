@@ -0,0 +1,111 @@
+package services
+
+import (
+	"bff/models"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// modelRecordingProvider remembers the model each stream was asked for
+type modelRecordingProvider struct {
+	FakeProvider
+	models chan string
+}
+
+func (p *modelRecordingProvider) StreamCompletion(ctx context.Context, request models.ChatRequest, responseChan chan<- models.StreamChunk, errorChan chan<- error) {
+	p.models <- request.Model
+	p.FakeProvider.StreamCompletion(ctx, request, responseChan, errorChan)
+}
+
+func TestComparisonService(t *testing.T) {
+	request := models.ChatRequest{Messages: []models.Message{{Role: "user", Content: "Hi there"}}}
+	fast := ComparisonTarget{Provider: &FakeProvider{ProviderName: "fast", Reply: "one two"}, Model: "small"}
+	slow := ComparisonTarget{Provider: &FakeProvider{ProviderName: "slow", Reply: "three four five"}}
+	broken := ComparisonTarget{Provider: &FakeProvider{ProviderName: "broken", Err: &UpstreamError{StatusCode: 500}}}
+
+	t.Run("should select targets by label", func(t *testing.T) {
+		service := NewComparisonService([]ComparisonTarget{fast, slow})
+
+		all, err := service.Select(nil)
+		require.NoError(t, err)
+		assert.Len(t, all, 2)
+
+		selected, err := service.Select([]string{"slow"})
+		require.NoError(t, err)
+		assert.Equal(t, []ComparisonTarget{slow}, selected)
+
+		_, err = service.Select([]string{"fast"})
+		assert.Error(t, err)
+		assert.Equal(t, []string{"fast:small", "slow"}, service.Labels())
+	})
+
+	t.Run("should refuse to compare without configured models", func(t *testing.T) {
+		_, err := NewComparisonService(nil).Select(nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("should multiplex the answers and sum them up", func(t *testing.T) {
+		service := NewComparisonService([]ComparisonTarget{fast, slow, broken})
+		targets, _ := service.Select(nil)
+
+		events := NewEventLog(0)
+		service.Compare(context.Background(), "msg_1", request, targets, events)
+
+		all, _, closed := events.Since(0)
+		require.True(t, closed)
+
+		meta := all[0].Payload.(models.ComparisonMeta)
+		assert.Equal(t, []string{"fast:small", "slow", "broken"}, meta.Models)
+
+		content := make(map[string]string)
+		for _, event := range all {
+			if delta, ok := event.Payload.(models.ComparisonDelta); ok {
+				content[delta.Model] += delta.Content
+			}
+		}
+		assert.Equal(t, map[string]string{"fast:small": "one two", "slow": "three four five"}, content)
+
+		last := all[len(all)-1]
+		require.Equal(t, models.ComparisonEventSummary, last.Type)
+		results := last.Payload.(models.ComparisonSummary).Results
+		require.Len(t, results, 3)
+
+		assert.Equal(t, "fast:small", results[0].Model)
+		assert.Equal(t, "fast", results[0].Provider)
+		assert.Equal(t, "stop", results[0].FinishReason)
+		assert.Equal(t, 2, results[0].Usage.CompletionTokens)
+		assert.Equal(t, 3, results[1].Usage.CompletionTokens)
+
+		assert.Equal(t, "error", results[2].FinishReason)
+		assert.Equal(t, "upstream_error", results[2].ErrorCode)
+		assert.Nil(t, results[2].Usage)
+	})
+
+	t.Run("should ask each target for its own model", func(t *testing.T) {
+		pinned := &modelRecordingProvider{FakeProvider: FakeProvider{ProviderName: "pinned"}, models: make(chan string, 1)}
+		fallback := &modelRecordingProvider{FakeProvider: FakeProvider{ProviderName: "fallback"}, models: make(chan string, 1)}
+		targets := []ComparisonTarget{{Provider: pinned, Model: "small"}, {Provider: fallback}}
+
+		pickedRequest := request
+		pickedRequest.Model = "gpt-4o"
+		NewComparisonService(targets).Compare(context.Background(), "msg_1", pickedRequest, targets, NewEventLog(0))
+
+		assert.Equal(t, "small", <-pinned.models)
+		assert.Empty(t, <-fallback.models)
+	})
+
+	t.Run("should report models stopped by the client as cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		events := NewEventLog(0)
+		NewComparisonService(nil).Compare(ctx, "msg_1", request, []ComparisonTarget{fast}, events)
+
+		all, _, _ := events.Since(0)
+		results := all[len(all)-1].Payload.(models.ComparisonSummary).Results
+		assert.Equal(t, "cancelled", results[0].FinishReason)
+	})
+}
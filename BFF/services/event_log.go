@@ -0,0 +1,177 @@
+package services
+
+import (
+	"bff/models"
+	"errors"
+	"sync"
+)
+
+// DefaultSubscriberBuffer is how many live events a subscriber may fall
+// behind when no other size is configured
+const DefaultSubscriberBuffer = 1024
+
+// ErrSubscriberEvicted ends a subscription whose queue overflowed
+var ErrSubscriberEvicted = errors.New("subscriber fell too far behind and was evicted")
+
+// EventLog buffers the events of a generation, so a client can replay
+// what it missed after a given event ID and then follow new events live.
+// It is the broadcast hub of the generation: every subscriber gets each
+// new event through its own queue.
+type EventLog struct {
+	events []models.StreamEvent
+	closed bool
+	// changed is closed and replaced whenever an event is appended or the
+	// log is closed, waking up everyone waiting in Since
+	changed          chan struct{}
+	subscribers      map[*Subscription]struct{}
+	subscriberBuffer int
+	mu               sync.Mutex
+}
+
+// NewEventLog creates a log whose subscribers may fall subscriberBuffer
+// events behind before they are evicted, or DefaultSubscriberBuffer if it
+// is not positive.
+func NewEventLog(subscriberBuffer int) *EventLog {
+	if subscriberBuffer <= 0 {
+		subscriberBuffer = DefaultSubscriberBuffer
+	}
+	return &EventLog{
+		changed:          make(chan struct{}),
+		subscribers:      make(map[*Subscription]struct{}),
+		subscriberBuffer: subscriberBuffer,
+	}
+}
+
+// Append adds an event with the next ID, counting from 1. Events appended
+// after Close are dropped.
+func (l *EventLog) Append(eventType string, payload any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return
+	}
+	event := models.StreamEvent{
+		ID:      int64(len(l.events) + 1),
+		Type:    eventType,
+		Payload: payload,
+	}
+	l.events = append(l.events, event)
+	l.notify()
+
+	for sub := range l.subscribers {
+		select {
+		case sub.queue <- event:
+		default:
+			// A slow subscriber must not hold up the generation or the
+			// others. It can resume from the log after its last event.
+			sub.evicted = true
+			l.unsubscribe(sub)
+		}
+	}
+}
+
+// Close marks the log as complete
+func (l *EventLog) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.closed {
+		l.closed = true
+		l.notify()
+		for sub := range l.subscribers {
+			l.unsubscribe(sub)
+		}
+	}
+}
+
+// Since returns the events after afterId and whether the log is closed.
+// When it is not, the returned channel is closed once there is more to read.
+func (l *EventLog) Since(afterId int64) ([]models.StreamEvent, <-chan struct{}, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.since(afterId), l.changed, l.closed
+}
+
+// Subscribe follows the log after afterId: the events already logged are
+// in the subscription's backlog, and later ones are queued for it.
+func (l *EventLog) Subscribe(afterId int64) *Subscription {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sub := &Subscription{
+		log:     l,
+		backlog: l.since(afterId),
+		queue:   make(chan models.StreamEvent, l.subscriberBuffer),
+	}
+	if l.closed {
+		close(sub.queue)
+	} else {
+		l.subscribers[sub] = struct{}{}
+	}
+	return sub
+}
+
+// since returns the events after afterId; l.mu must be held
+func (l *EventLog) since(afterId int64) []models.StreamEvent {
+	if afterId >= int64(len(l.events)) {
+		return nil
+	}
+	// Capped so the caller can't append into the log's backing array
+	return l.events[max(afterId, 0):len(l.events):len(l.events)]
+}
+
+// unsubscribe ends a subscription; l.mu must be held
+func (l *EventLog) unsubscribe(sub *Subscription) {
+	if _, subscribed := l.subscribers[sub]; subscribed {
+		delete(l.subscribers, sub)
+		close(sub.queue)
+	}
+}
+
+// notify wakes up waiting readers; l.mu must be held
+func (l *EventLog) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Subscription is one client following an EventLog
+type Subscription struct {
+	log     *EventLog
+	backlog []models.StreamEvent
+	queue   chan models.StreamEvent
+	// evicted is guarded by log.mu
+	evicted bool
+}
+
+// Backlog returns the events that were logged before subscribing
+func (s *Subscription) Backlog() []models.StreamEvent {
+	return s.backlog
+}
+
+// Events delivers the events logged after subscribing. It is closed when
+// the log is closed, the subscriber is evicted or the subscription closed.
+func (s *Subscription) Events() <-chan models.StreamEvent {
+	return s.queue
+}
+
+// Err returns ErrSubscriberEvicted if the subscription was dropped for
+// falling behind
+func (s *Subscription) Err() error {
+	s.log.mu.Lock()
+	defer s.log.mu.Unlock()
+
+	if s.evicted {
+		return ErrSubscriberEvicted
+	}
+	return nil
+}
+
+// Close stops the queueing of new events for the subscriber
+func (s *Subscription) Close() {
+	s.log.mu.Lock()
+	defer s.log.mu.Unlock()
+
+	s.log.unsubscribe(s)
+}
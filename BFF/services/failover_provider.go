@@ -0,0 +1,189 @@
+package services
+
+import (
+	"bff/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoProviderAvailable is returned when every provider in the chain has
+// an open circuit breaker
+var ErrNoProviderAvailable = errors.New("no LLM provider is available")
+
+// FailoverTarget is one step of the failover chain. Model overrides the
+// provider's default model when set.
+type FailoverTarget struct {
+	Provider Provider
+	Model    string
+}
+
+// FailoverProvider tries an ordered chain of providers and models until one
+// answers. Each provider has its own circuit breaker, shared by every chain
+// step that uses it, so a degraded vendor is skipped without waiting on it.
+// A stream that fails after its first chunk is not handed to the next
+// provider, as the client has already seen part of the reply, and neither
+// is a request the provider rejected.
+type FailoverProvider struct {
+	targets  []FailoverTarget
+	breakers map[string]*CircuitBreaker
+}
+
+func NewFailoverProvider(targets []FailoverTarget, config CircuitBreakerConfig) *FailoverProvider {
+	breakers := make(map[string]*CircuitBreaker)
+	for _, target := range targets {
+		if _, exists := breakers[target.Provider.Name()]; !exists {
+			breakers[target.Provider.Name()] = NewCircuitBreaker(config)
+		}
+	}
+	return &FailoverProvider{
+		targets:  targets,
+		breakers: breakers,
+	}
+}
+
+func (p *FailoverProvider) Name() string {
+	names := make([]string, 0, len(p.targets))
+	for _, target := range p.targets {
+		names = append(names, target.Provider.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+func (p *FailoverProvider) StreamCompletion(ctx context.Context, request models.ChatRequest, responseChan chan<- models.StreamChunk, errorChan chan<- error) {
+	defer close(responseChan)
+	defer close(errorChan)
+
+	lastErr := ErrNoProviderAvailable
+	for i, target := range p.targets {
+		breaker := p.breakers[target.Provider.Name()]
+		if !breaker.Allow() {
+			continue
+		}
+
+		attemptChan := make(chan models.StreamChunk, cap(responseChan))
+		attemptErrorChan := make(chan error, 1)
+		go target.Provider.StreamCompletion(ctx, p.targetRequest(i, request), attemptChan, attemptErrorChan)
+
+		started := false
+		for chunk := range attemptChan {
+			if chunk.Retry == nil {
+				started = true
+			}
+			chunk.Provider = target.Provider.Name()
+			if !sendChunk(ctx, responseChan, chunk) {
+				breaker.Release()
+				errorChan <- ctx.Err()
+				return
+			}
+		}
+
+		err := <-attemptErrorChan
+		if err == nil {
+			breaker.Success()
+			return
+		}
+
+		// A cancelled call says nothing about the provider's health, and a
+		// rejected request would fail the same way everywhere
+		if ctx.Err() != nil || !isProviderFailure(err) {
+			breaker.Release()
+			errorChan <- err
+			return
+		}
+
+		breaker.Failure()
+		if started {
+			errorChan <- err
+			return
+		}
+		lastErr = fmt.Errorf("%s: %w", target.Provider.Name(), err)
+	}
+
+	errorChan <- lastErr
+}
+
+func (p *FailoverProvider) Complete(ctx context.Context, request models.ChatRequest) (*models.ChatResponse, error) {
+	lastErr := ErrNoProviderAvailable
+	for i, target := range p.targets {
+		breaker := p.breakers[target.Provider.Name()]
+		if !breaker.Allow() {
+			continue
+		}
+
+		response, err := target.Provider.Complete(ctx, p.targetRequest(i, request))
+		if err == nil {
+			breaker.Success()
+			response.Provider = target.Provider.Name()
+			return response, nil
+		}
+
+		if ctx.Err() != nil || !isProviderFailure(err) {
+			breaker.Release()
+			return nil, err
+		}
+
+		breaker.Failure()
+		lastErr = fmt.Errorf("%s: %w", target.Provider.Name(), err)
+	}
+
+	return nil, lastErr
+}
+
+// isProviderFailure reports whether err says the provider is unhealthy:
+// retryable upstream errors, which include failed connections, and
+// timeouts. Anything else, like a 400 for a malformed or too long request,
+// is the request's fault, so it neither counts against the provider's
+// breaker nor is tried on the next one.
+func isProviderFailure(err error) bool {
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) {
+		return upstreamErr.Retryable
+	}
+	var timeoutErr *TimeoutError
+	return errors.As(err, &timeoutErr)
+}
+
+// ValidateAPIKey validates every provider in the chain
+func (p *FailoverProvider) ValidateAPIKey() error {
+	var errs []error
+	validated := make(map[string]bool)
+	for _, target := range p.targets {
+		name := target.Provider.Name()
+		if validated[name] {
+			continue
+		}
+		validated[name] = true
+
+		if err := target.Provider.ValidateAPIKey(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetStatus returns the breaker state of every provider in chain order
+func (p *FailoverProvider) GetStatus() []models.ProviderStatus {
+	var statuses []models.ProviderStatus
+	seen := make(map[string]bool)
+	for _, target := range p.targets {
+		name := target.Provider.Name()
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		statuses = append(statuses, models.ProviderStatus{Provider: name, State: p.breakers[name].State()})
+	}
+	return statuses
+}
+
+// targetRequest applies the chain step's model. A model the client picked
+// explicitly only makes sense for the primary provider, so fallbacks always
+// use their own.
+func (p *FailoverProvider) targetRequest(index int, request models.ChatRequest) models.ChatRequest {
+	if index > 0 || request.Model == "" {
+		request.Model = p.targets[index].Model
+	}
+	return request
+}
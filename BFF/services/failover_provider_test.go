@@ -0,0 +1,159 @@
+package services
+
+import (
+	"bff/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute})
+	breaker.now = func() time.Time { return now }
+
+	t.Run("should open after consecutive failures", func(t *testing.T) {
+		assert.True(t, breaker.Allow())
+		breaker.Failure()
+		assert.Equal(t, CircuitClosed, breaker.State())
+
+		assert.True(t, breaker.Allow())
+		breaker.Failure()
+		assert.Equal(t, CircuitOpen, breaker.State())
+		assert.False(t, breaker.Allow())
+	})
+
+	t.Run("should let a single probe through after the timeout", func(t *testing.T) {
+		now = now.Add(time.Minute)
+
+		assert.True(t, breaker.Allow())
+		assert.Equal(t, CircuitHalfOpen, breaker.State())
+		assert.False(t, breaker.Allow())
+
+		breaker.Failure()
+		assert.Equal(t, CircuitOpen, breaker.State())
+		assert.False(t, breaker.Allow())
+	})
+
+	t.Run("should close when the probe succeeds", func(t *testing.T) {
+		now = now.Add(time.Minute)
+
+		assert.True(t, breaker.Allow())
+		breaker.Success()
+		assert.Equal(t, CircuitClosed, breaker.State())
+		assert.True(t, breaker.Allow())
+	})
+}
+
+func TestFailoverProvider(t *testing.T) {
+	request := models.ChatRequest{Messages: []models.Message{{Role: "user", Content: "Hi"}}}
+
+	t.Run("should fall back to the next provider and report who answered", func(t *testing.T) {
+		primary := &FakeProvider{ProviderName: "primary", Err: &UpstreamError{StatusCode: 503, Message: "down", Retryable: true}}
+		secondary := &FakeProvider{ProviderName: "secondary", Reply: "from secondary"}
+		provider := NewFailoverProvider([]FailoverTarget{
+			{Provider: primary},
+			{Provider: secondary, Model: "backup-model"},
+		}, CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+
+		content, last, err := collectStream(provider, request)
+
+		require.NoError(t, err)
+		assert.Equal(t, "from secondary", content)
+		assert.Equal(t, "secondary", last.Provider)
+		assert.Equal(t, "backup-model", last.Model)
+		assert.Equal(t, []models.ProviderStatus{
+			{Provider: "primary", State: CircuitOpen},
+			{Provider: "secondary", State: CircuitClosed},
+		}, provider.GetStatus())
+	})
+
+	t.Run("should skip providers with an open breaker", func(t *testing.T) {
+		primary := &FakeProvider{ProviderName: "primary", Err: &UpstreamError{Retryable: true, Message: "down"}}
+		secondary := &FakeProvider{ProviderName: "secondary", Reply: "ok"}
+		provider := NewFailoverProvider([]FailoverTarget{
+			{Provider: primary},
+			{Provider: secondary},
+		}, CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+
+		_, err := provider.Complete(context.Background(), request)
+		require.NoError(t, err)
+
+		// The primary recovers but its breaker is still open
+		primary.Err = nil
+		response, err := provider.Complete(context.Background(), request)
+		require.NoError(t, err)
+		assert.Equal(t, "secondary", response.Provider)
+	})
+
+	t.Run("should keep the client's model for the primary only", func(t *testing.T) {
+		primary := &FakeProvider{ProviderName: "primary", Err: &UpstreamError{Retryable: true, Message: "down"}}
+		secondary := &FakeProvider{ProviderName: "secondary", Model: "secondary-default"}
+		provider := NewFailoverProvider([]FailoverTarget{
+			{Provider: primary, Model: "primary-model"},
+			{Provider: secondary},
+		}, CircuitBreakerConfig{FailureThreshold: 5})
+
+		response, err := provider.Complete(context.Background(), models.ChatRequest{Model: "client-model", Messages: request.Messages})
+
+		require.NoError(t, err)
+		assert.Equal(t, "secondary-default", response.Model)
+	})
+
+	t.Run("should fail over from a provider that stalls", func(t *testing.T) {
+		config := TimeoutConfig{FirstToken: 20 * time.Millisecond, Idle: 20 * time.Millisecond, Total: time.Second}
+		stalled := &FakeProvider{ProviderName: "primary", Reply: "too late", ChunkDelay: time.Hour}
+		secondary := &FakeProvider{ProviderName: "secondary", Reply: "from secondary"}
+		failover := NewFailoverProvider([]FailoverTarget{
+			{Provider: NewTimeoutProvider(stalled, config.ForTarget())},
+			{Provider: NewTimeoutProvider(secondary, config.ForTarget())},
+		}, CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+		provider := NewTimeoutProvider(failover, config.ForChain())
+
+		content, last, err := collectStream(provider, request)
+
+		require.NoError(t, err)
+		assert.Equal(t, "from secondary", content)
+		assert.Equal(t, "secondary", last.Provider)
+		assert.Equal(t, []models.ProviderStatus{
+			{Provider: "primary", State: CircuitOpen},
+			{Provider: "secondary", State: CircuitClosed},
+		}, failover.GetStatus())
+	})
+
+	t.Run("should not fail over or count rejected requests", func(t *testing.T) {
+		primary := &FakeProvider{ProviderName: "primary", Err: &UpstreamError{StatusCode: 400, Message: "context length exceeded"}}
+		secondary := &FakeProvider{ProviderName: "secondary", Reply: "ok"}
+		provider := NewFailoverProvider([]FailoverTarget{
+			{Provider: primary},
+			{Provider: secondary},
+		}, CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+
+		_, _, err := collectStream(provider, request)
+		assert.EqualError(t, err, "context length exceeded")
+
+		_, err = provider.Complete(context.Background(), request)
+		assert.EqualError(t, err, "context length exceeded")
+
+		assert.Equal(t, []models.ProviderStatus{
+			{Provider: "primary", State: CircuitClosed},
+			{Provider: "secondary", State: CircuitClosed},
+		}, provider.GetStatus())
+	})
+
+	t.Run("should fail when every provider fails", func(t *testing.T) {
+		provider := NewFailoverProvider([]FailoverTarget{
+			{Provider: &FakeProvider{ProviderName: "a", Err: &UpstreamError{Retryable: true, Message: "a down"}}},
+			{Provider: &FakeProvider{ProviderName: "b", Err: &UpstreamError{Retryable: true, Message: "b down"}}},
+		}, CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+
+		_, _, err := collectStream(provider, request)
+		assert.EqualError(t, err, "b: b down")
+
+		_, _, err = collectStream(provider, request)
+		assert.ErrorIs(t, err, ErrNoProviderAvailable)
+	})
+}
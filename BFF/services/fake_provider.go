@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bff/models"
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// FakeProvider is a deterministic Provider for offline development and
+// tests. It streams Reply word by word, or echoes the last user message
+// when Reply is empty. ProviderName lets tests tell several fakes apart.
+type FakeProvider struct {
+	ProviderName string
+	Reply        string
+	Model        string
+	Err          error
+	ChunkDelay   time.Duration
+}
+
+func NewFakeProvider(model string) *FakeProvider {
+	if model == "" {
+		model = "fake-model"
+	}
+	return &FakeProvider{Model: model}
+}
+
+func (p *FakeProvider) Name() string {
+	if p.ProviderName != "" {
+		return p.ProviderName
+	}
+	return "fake"
+}
+
+func (p *FakeProvider) StreamCompletion(ctx context.Context, request models.ChatRequest, responseChan chan<- models.StreamChunk, errorChan chan<- error) {
+	defer close(responseChan)
+	defer close(errorChan)
+
+	if p.Err != nil {
+		errorChan <- p.Err
+		return
+	}
+
+	words := strings.SplitAfter(p.reply(request), " ")
+	for _, word := range words {
+		if err := sleepContext(ctx, p.ChunkDelay); err != nil {
+			errorChan <- err
+			return
+		}
+		if !sendChunk(ctx, responseChan, models.StreamChunk{Content: word, Model: p.model(request)}) {
+			errorChan <- ctx.Err()
+			return
+		}
+	}
+	if !sendChunk(ctx, responseChan, models.StreamChunk{FinishReason: "stop", Model: p.model(request), Usage: p.usage(request)}) {
+		errorChan <- ctx.Err()
+		return
+	}
+}
+
+func (p *FakeProvider) Complete(ctx context.Context, request models.ChatRequest) (*models.ChatResponse, error) {
+	if p.Err != nil {
+		return nil, p.Err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &models.ChatResponse{
+		Content:      p.reply(request),
+		FinishReason: "stop",
+		Model:        p.model(request),
+		Usage:        p.usage(request),
+	}, nil
+}
+
+func (p *FakeProvider) ValidateAPIKey() error {
+	if p.Err != nil {
+		return errors.Join(errors.New("fake provider is configured to fail"), p.Err)
+	}
+	return nil
+}
+
+func (p *FakeProvider) reply(request models.ChatRequest) string {
+	if p.Reply != "" {
+		return p.Reply
+	}
+	for i := len(request.Messages) - 1; i >= 0; i-- {
+		if request.Messages[i].Role == "user" {
+			return "You said: " + request.Messages[i].Content
+		}
+	}
+	return "You said nothing"
+}
+
+// usage counts words as tokens, which is close enough for an offline provider
+func (p *FakeProvider) usage(request models.ChatRequest) *models.Usage {
+	promptTokens := 0
+	for _, message := range request.Messages {
+		promptTokens += len(strings.Fields(message.Content))
+	}
+	return models.NewUsage(promptTokens, len(strings.Fields(p.reply(request))))
+}
+
+func (p *FakeProvider) model(request models.ChatRequest) string {
+	if request.Model != "" {
+		return request.Model
+	}
+	return p.Model
+}
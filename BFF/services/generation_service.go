@@ -0,0 +1,390 @@
+package services
+
+import (
+	"bff/models"
+	"bff/sse"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses of a generation as reported by Snapshot
+const (
+	GenerationRunning      = "running"
+	GenerationCompleted    = "completed"
+	GenerationFailed       = "failed"
+	GenerationCancelled    = "cancelled"
+	GenerationDisconnected = "disconnected"
+)
+
+// Generation is a completion running in the background. Its events are
+// buffered in Events, so clients can attach, drop off and resume.
+type Generation struct {
+	Id        string
+	UserId    string
+	MessageId string
+	CreatedAt time.Time
+	Events    *EventLog
+
+	// background generations run to completion even if nobody follows them
+	background  bool
+	cancel      context.CancelFunc
+	cancelled   bool
+	finished    bool
+	subscribers int
+	detachTimer *time.Timer
+}
+
+// GenerationConfig controls how long generations are kept around
+type GenerationConfig struct {
+	// ResumeWindow is how long a generation started by a stream keeps
+	// running after its last client left, waiting for it to reconnect
+	ResumeWindow time.Duration
+	// Retention is how long a finished generation can still be polled
+	// and replayed
+	Retention time.Duration
+	// SubscriberBuffer is how many events a client following a generation
+	// may fall behind before it is dropped
+	SubscriberBuffer int
+}
+
+// GenerationService runs generations independently of the request that
+// started them, so clients can poll them, attach to them and resume them.
+type GenerationService struct {
+	messageService *MessageService
+	provider       Provider
+	config         GenerationConfig
+	generations    map[string]*Generation
+	// latest maps a message ID to the generation last started for it
+	latest map[string]*Generation
+	mu     sync.Mutex
+}
+
+func NewGenerationService(messageService *MessageService, provider Provider, config GenerationConfig) *GenerationService {
+	return &GenerationService{
+		messageService: messageService,
+		provider:       provider,
+		config:         config,
+		generations:    make(map[string]*Generation),
+		latest:         make(map[string]*Generation),
+	}
+}
+
+// Start registers a generation answering the user's message and runs the
+// request in the background. The answer is saved against the message when
+// the generation ends. It is stopped when its clients leave for good.
+func (s *GenerationService) Start(userId string, messageId string, request models.ChatRequest) *Generation {
+	return s.start(userId, messageId, request, false)
+}
+
+// StartBackground is like Start, but the generation runs to completion
+// whether or not anyone follows it.
+func (s *GenerationService) StartBackground(userId string, messageId string, request models.ChatRequest) *Generation {
+	return s.start(userId, messageId, request, true)
+}
+
+// StartOrJoin returns the generation still running for the message, or
+// starts one like Start if there is none. The lookup and the start happen
+// under one lock, so concurrent clients share a single generation. joined
+// reports whether an existing generation was returned.
+func (s *GenerationService) StartOrJoin(userId string, messageId string, request models.ChatRequest) (gen *Generation, joined bool) {
+	s.mu.Lock()
+	if inFlight, exists := s.latest[messageId]; exists && !inFlight.finished {
+		s.mu.Unlock()
+		return inFlight, true
+	}
+	gen, ctx := s.newGeneration(userId, messageId, false)
+	s.generations[gen.Id] = gen
+	s.latest[messageId] = gen
+	s.mu.Unlock()
+
+	go s.run(ctx, gen, request)
+	return gen, false
+}
+
+func (s *GenerationService) start(userId string, messageId string, request models.ChatRequest, background bool) *Generation {
+	gen, ctx := s.newGeneration(userId, messageId, background)
+
+	s.mu.Lock()
+	s.generations[gen.Id] = gen
+	s.latest[messageId] = gen
+	s.mu.Unlock()
+
+	go s.run(ctx, gen, request)
+	return gen
+}
+
+// newGeneration creates a generation with its meta event, ready to be
+// registered and run
+func (s *GenerationService) newGeneration(userId string, messageId string, background bool) (*Generation, context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	gen := &Generation{
+		Id:         fmt.Sprintf("gen_%d", time.Now().UnixNano()),
+		UserId:     userId,
+		MessageId:  messageId,
+		CreatedAt:  time.Now(),
+		Events:     NewEventLog(s.config.SubscriberBuffer),
+		background: background,
+		cancel:     cancel,
+	}
+	gen.Events.Append(models.StreamEventMeta, models.StreamMeta{
+		Version:      models.StreamEventVersion,
+		GenerationId: gen.Id,
+		MessageId:    messageId,
+	})
+	return gen, ctx
+}
+
+// Get returns a running or recently finished generation by ID
+func (s *GenerationService) Get(generationId string) (*Generation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gen, exists := s.generations[generationId]
+	return gen, exists
+}
+
+// Latest returns the generation last started for a message, as long as it
+// is still running or retained
+func (s *GenerationService) Latest(messageId string) (*Generation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gen, exists := s.latest[messageId]
+	return gen, exists
+}
+
+// InFlight returns the generation still running for a message, so another
+// client can follow it instead of asking the provider again
+func (s *GenerationService) InFlight(messageId string) (*Generation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gen, exists := s.latest[messageId]
+	if !exists || gen.finished {
+		return nil, false
+	}
+	return gen, true
+}
+
+// Attach registers a client following the generation's events, which keeps
+// it running. Every Attach must be paired with a Detach.
+func (s *GenerationService) Attach(gen *Generation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gen.subscribers++
+	if gen.detachTimer != nil {
+		gen.detachTimer.Stop()
+		gen.detachTimer = nil
+	}
+}
+
+// Detach unregisters a client. When the last one leaves a running
+// generation, it is stopped unless someone attaches within the resume
+// window. Background generations keep running.
+func (s *GenerationService) Detach(gen *Generation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gen.subscribers--
+	if gen.subscribers > 0 || gen.finished || gen.background {
+		return
+	}
+	gen.detachTimer = time.AfterFunc(s.config.ResumeWindow, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if gen.subscribers == 0 {
+			gen.cancel()
+		}
+	})
+}
+
+// Cancel stops an in-flight generation. It returns false if the generation
+// doesn't exist, has already finished or belongs to another user.
+func (s *GenerationService) Cancel(generationId string, userId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gen, exists := s.generations[generationId]
+	if !exists || gen.UserId != userId || gen.finished {
+		return false
+	}
+	gen.cancelled = true
+	gen.cancel()
+	return true
+}
+
+// run streams the completion into the generation's event log and records
+// the answer once the stream ends.
+func (s *GenerationService) run(ctx context.Context, gen *Generation, request models.ChatRequest) {
+	defer s.finish(gen)
+
+	responseChan := make(chan models.StreamChunk, 100)
+	errorChan := make(chan error, 1)
+	go s.provider.StreamCompletion(ctx, request, responseChan, errorChan)
+
+	recorder := NewResponseRecorder(gen.MessageId)
+	answeredBy := ""
+	deltas := 0
+
+	// Providers close responseChan once they are done, also when ctx is
+	// cancelled, so every chunk they sent is recorded before the error
+	for chunk := range responseChan {
+		if chunk.Retry != nil {
+			// Upstream failed before the first token and is being retried
+			gen.Events.Append(models.StreamEventRetrying, models.StreamRetrying{Version: models.StreamEventVersion, RetryInfo: *chunk.Retry})
+			continue
+		}
+
+		if chunk.Provider != answeredBy {
+			// Tell the client which provider of the failover chain answered
+			answeredBy = chunk.Provider
+			gen.Events.Append(models.StreamEventMeta, models.StreamMeta{Version: models.StreamEventVersion, Provider: chunk.Provider, Model: chunk.Model})
+		}
+
+		recorder.Add(chunk)
+		if chunk.Content == "" {
+			continue
+		}
+
+		gen.Events.Append(models.StreamEventDelta, models.StreamDelta{Version: models.StreamEventVersion, Index: deltas, Content: chunk.Content})
+		deltas++
+	}
+	// The provider closes errorChan before responseChan, so a nil error
+	// here means the stream completed
+	err := <-errorChan
+
+	switch {
+	case err == nil:
+		s.complete(gen, recorder.Finish("stop"))
+	case ctx.Err() != nil:
+		s.stop(gen, recorder)
+	default:
+		s.messageService.SaveResponse(recorder.Finish("error"))
+		gen.Events.Append(models.StreamEventError, models.StreamError{
+			Version: models.StreamEventVersion,
+			Code:    ErrorCode(err),
+			Message: fmt.Sprintf("Error: %s", err.Error()),
+		})
+	}
+}
+
+// stop records a generation whose context ended early, either through
+// Cancel or because no client came back within the resume window.
+func (s *GenerationService) stop(gen *Generation, recorder *ResponseRecorder) {
+	s.mu.Lock()
+	cancelled := gen.cancelled
+	s.mu.Unlock()
+
+	if !cancelled {
+		// Client disconnected
+		s.messageService.SaveResponse(recorder.Finish("disconnected"))
+		return
+	}
+	s.complete(gen, recorder.Finish("cancelled"))
+}
+
+// complete saves the answer and ends the stream with a done event
+func (s *GenerationService) complete(gen *Generation, response models.AssistantResponse) {
+	s.messageService.SaveResponse(response)
+	gen.Events.Append(models.StreamEventDone, models.StreamDone{
+		Version:      models.StreamEventVersion,
+		FinishReason: response.FinishReason,
+		Model:        response.Model,
+		Provider:     response.Provider,
+		Usage:        response.Usage,
+		LatencyMs:    response.LatencyMs,
+		DurationMs:   response.DurationMs,
+	})
+}
+
+// finish closes the event log and forgets the generation once its
+// retention has passed.
+func (s *GenerationService) finish(gen *Generation) {
+	gen.Events.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gen.finished = true
+	gen.cancel()
+	if gen.detachTimer != nil {
+		gen.detachTimer.Stop()
+	}
+
+	time.AfterFunc(s.config.Retention, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.generations, gen.Id)
+		if s.latest[gen.MessageId] == gen {
+			delete(s.latest, gen.MessageId)
+		}
+	})
+}
+
+// Snapshot summarizes the generation from its events so far
+func (gen *Generation) Snapshot() models.GenerationStatus {
+	events, _, closed := gen.Events.Since(0)
+	status := models.GenerationStatus{
+		GenerationId: gen.Id,
+		MessageId:    gen.MessageId,
+		Status:       GenerationRunning,
+		CreatedAt:    gen.CreatedAt,
+	}
+
+	var content strings.Builder
+	for _, event := range events {
+		status.LastEventId = event.ID
+
+		switch payload := event.Payload.(type) {
+		case models.StreamMeta:
+			if payload.Provider != "" {
+				status.Provider, status.Model = payload.Provider, payload.Model
+			}
+		case models.StreamDelta:
+			content.WriteString(payload.Content)
+		case models.StreamDone:
+			status.Status = GenerationCompleted
+			if payload.FinishReason == "cancelled" {
+				status.Status = GenerationCancelled
+			}
+			status.FinishReason, status.Usage = payload.FinishReason, payload.Usage
+			if payload.Model != "" {
+				status.Model = payload.Model
+			}
+		case models.StreamError:
+			status.Status = GenerationFailed
+			status.ErrorCode, status.Error = payload.Code, payload.Message
+		}
+	}
+	status.Content = content.String()
+
+	// Stopped after its clients left, without a done or error event
+	if closed && status.Status == GenerationRunning {
+		status.Status = GenerationDisconnected
+	}
+	return status
+}
+
+// ErrorCode gives clients a machine-readable reason for a failed generation
+func ErrorCode(err error) string {
+	var timeoutErr *TimeoutError
+	var upstreamErr *UpstreamError
+	var decodeErr *sse.DecodeError
+	switch {
+	case errors.As(err, &timeoutErr):
+		return timeoutErr.Code
+	case errors.Is(err, ErrNoProviderAvailable):
+		return "no_provider_available"
+	case errors.As(err, &upstreamErr), errors.As(err, &decodeErr), errors.Is(err, sse.ErrEventTooLarge):
+		return "upstream_error"
+	default:
+		return "internal_error"
+	}
+}
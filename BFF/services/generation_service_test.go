@@ -0,0 +1,362 @@
+package services
+
+import (
+	"bff/models"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestGenerationService answers with a FakeProvider and stores replies
+// for message msg_1 of user u1
+func newTestGenerationService(provider Provider, resumeWindow time.Duration) (*GenerationService, *MessageService) {
+	messageService := NewMessageService()
+	messageService.AddMessage(models.MessageUserTable{MessageId: "msg_1", UserId: "u1", MessageContent: "Hi"})
+	return NewGenerationService(messageService, provider, GenerationConfig{ResumeWindow: resumeWindow, Retention: resumeWindow}), messageService
+}
+
+// waitForEvents follows the generation's log until it is closed
+func waitForEvents(t *testing.T, gen *Generation) []models.StreamEvent {
+	timeout := time.After(2 * time.Second)
+	for {
+		events, changed, closed := gen.Events.Since(0)
+		if closed {
+			return events
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			require.FailNow(t, "generation did not finish")
+		}
+	}
+}
+
+func eventTypes(events []models.StreamEvent) []string {
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+// brokenStreamProvider sends its words at once and fails right after
+type brokenStreamProvider struct {
+	FakeProvider
+	words int
+}
+
+func (p *brokenStreamProvider) StreamCompletion(ctx context.Context, request models.ChatRequest, responseChan chan<- models.StreamChunk, errorChan chan<- error) {
+	defer close(responseChan)
+	defer close(errorChan)
+
+	for range p.words {
+		responseChan <- models.StreamChunk{Content: "word "}
+	}
+	errorChan <- &UpstreamError{StatusCode: 502, Message: "connection reset"}
+}
+
+func TestGenerationService(t *testing.T) {
+	request := models.ChatRequest{Messages: []models.Message{{Role: "user", Content: "Hi there"}}}
+
+	t.Run("should buffer the stream and save the answer", func(t *testing.T) {
+		service, messageService := newTestGenerationService(NewFakeProvider(""), time.Minute)
+
+		gen := service.Start("u1", "msg_1", request)
+		events := waitForEvents(t, gen)
+
+		assert.Equal(t, []string{"meta", "delta", "delta", "delta", "delta", "done"}, eventTypes(events))
+		assert.Equal(t, gen.Id, events[0].Payload.(models.StreamMeta).GenerationId)
+		assert.Equal(t, 3, events[4].Payload.(models.StreamDelta).Index)
+		assert.Equal(t, "stop", events[5].Payload.(models.StreamDone).FinishReason)
+
+		response, exists := messageService.GetResponse("msg_1")
+		require.True(t, exists)
+		assert.Equal(t, "You said: Hi there", response.Content)
+
+		latest, exists := service.Latest("msg_1")
+		require.True(t, exists)
+		assert.Same(t, gen, latest)
+	})
+
+	t.Run("should cancel the generation for its owner only", func(t *testing.T) {
+		service, messageService := newTestGenerationService(&FakeProvider{ChunkDelay: time.Second}, time.Minute)
+		gen := service.Start("u1", "msg_1", request)
+
+		assert.False(t, service.Cancel(gen.Id, "u2"))
+		assert.True(t, service.Cancel(gen.Id, "u1"))
+
+		events := waitForEvents(t, gen)
+		last := events[len(events)-1]
+		assert.Equal(t, "cancelled", last.Payload.(models.StreamDone).FinishReason)
+
+		response, _ := messageService.GetResponse("msg_1")
+		assert.Equal(t, "cancelled", response.FinishReason)
+		assert.False(t, service.Cancel(gen.Id, "u1"))
+	})
+
+	t.Run("should report failures with a code", func(t *testing.T) {
+		service, _ := newTestGenerationService(&FakeProvider{Err: ErrNoProviderAvailable}, time.Minute)
+
+		events := waitForEvents(t, service.Start("u1", "msg_1", request))
+
+		last := events[len(events)-1]
+		assert.Equal(t, "no_provider_available", last.Payload.(models.StreamError).Code)
+	})
+
+	t.Run("should keep every chunk sent before the provider failed", func(t *testing.T) {
+		service, messageService := newTestGenerationService(&brokenStreamProvider{words: 50}, time.Minute)
+
+		events := waitForEvents(t, service.Start("u1", "msg_1", request))
+
+		deltas := 0
+		for _, event := range events {
+			if event.Type == models.StreamEventDelta {
+				deltas++
+			}
+		}
+		assert.Equal(t, 50, deltas)
+		assert.Equal(t, models.StreamEventError, events[len(events)-1].Type)
+
+		response, _ := messageService.GetResponse("msg_1")
+		assert.Equal(t, "error", response.FinishReason)
+		assert.Equal(t, strings.Repeat("word ", 50), response.Content)
+	})
+
+	t.Run("should keep running while a client reconnects within the window", func(t *testing.T) {
+		service, messageService := newTestGenerationService(&FakeProvider{ChunkDelay: 20 * time.Millisecond}, 200*time.Millisecond)
+		gen := service.Start("u1", "msg_1", request)
+
+		service.Attach(gen)
+		service.Detach(gen)
+		time.Sleep(50 * time.Millisecond)
+		service.Attach(gen)
+
+		waitForEvents(t, gen)
+		response, _ := messageService.GetResponse("msg_1")
+		assert.Equal(t, "stop", response.FinishReason)
+		service.Detach(gen)
+	})
+
+	t.Run("should stop once the last client is gone for the whole window", func(t *testing.T) {
+		service, messageService := newTestGenerationService(&FakeProvider{ChunkDelay: time.Second}, 20*time.Millisecond)
+		gen := service.Start("u1", "msg_1", request)
+
+		service.Attach(gen)
+		service.Detach(gen)
+
+		waitForEvents(t, gen)
+		response, _ := messageService.GetResponse("msg_1")
+		assert.Equal(t, "disconnected", response.FinishReason)
+	})
+
+	t.Run("should run background generations to completion without clients", func(t *testing.T) {
+		service, messageService := newTestGenerationService(&FakeProvider{ChunkDelay: 10 * time.Millisecond}, 10*time.Millisecond)
+		gen := service.StartBackground("u1", "msg_1", request)
+
+		service.Attach(gen)
+		service.Detach(gen)
+
+		waitForEvents(t, gen)
+		response, _ := messageService.GetResponse("msg_1")
+		assert.Equal(t, "stop", response.FinishReason)
+	})
+
+	t.Run("should share the in-flight generation of a message", func(t *testing.T) {
+		service, _ := newTestGenerationService(&FakeProvider{ChunkDelay: 20 * time.Millisecond}, time.Minute)
+		gen := service.Start("u1", "msg_1", request)
+
+		inFlight, exists := service.InFlight("msg_1")
+		require.True(t, exists)
+		assert.Same(t, gen, inFlight)
+
+		waitForEvents(t, gen)
+		require.Eventually(t, func() bool {
+			_, exists := service.InFlight("msg_1")
+			return !exists
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("should start a single generation for concurrent clients", func(t *testing.T) {
+		service, _ := newTestGenerationService(&FakeProvider{ChunkDelay: 20 * time.Millisecond}, time.Minute)
+
+		gens := make([]*Generation, 10)
+		joined := make([]bool, len(gens))
+		var wg sync.WaitGroup
+		for i := range gens {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				gens[i], joined[i] = service.StartOrJoin("u1", "msg_1", request)
+			}()
+		}
+		wg.Wait()
+
+		starts := 0
+		for i, gen := range gens {
+			assert.Same(t, gens[0], gen)
+			if !joined[i] {
+				starts++
+			}
+		}
+		assert.Equal(t, 1, starts)
+
+		waitForEvents(t, gens[0])
+		require.Eventually(t, func() bool {
+			_, exists := service.InFlight("msg_1")
+			return !exists
+		}, time.Second, 5*time.Millisecond)
+
+		next, rejoined := service.StartOrJoin("u1", "msg_1", request)
+		assert.False(t, rejoined)
+		assert.NotSame(t, gens[0], next)
+		waitForEvents(t, next)
+	})
+
+	t.Run("should forget finished generations after the window", func(t *testing.T) {
+		service, _ := newTestGenerationService(NewFakeProvider(""), 20*time.Millisecond)
+		gen := service.Start("u1", "msg_1", request)
+		waitForEvents(t, gen)
+
+		assert.Eventually(t, func() bool {
+			_, exists := service.Get(gen.Id)
+			return !exists
+		}, time.Second, 10*time.Millisecond)
+		_, exists := service.Latest("msg_1")
+		assert.False(t, exists)
+	})
+}
+
+func TestEventLog(t *testing.T) {
+	t.Run("should replay events after an ID and wake up readers", func(t *testing.T) {
+		log := NewEventLog(0)
+		log.Append("delta", "a")
+		log.Append("delta", "b")
+
+		events, changed, closed := log.Since(1)
+		require.Len(t, events, 1)
+		assert.Equal(t, int64(2), events[0].ID)
+		assert.False(t, closed)
+
+		log.Append("delta", "c")
+		select {
+		case <-changed:
+		default:
+			assert.Fail(t, "readers were not woken up")
+		}
+
+		log.Close()
+		log.Append("delta", "dropped")
+		events, _, closed = log.Since(2)
+		assert.True(t, closed)
+		require.Len(t, events, 1)
+		assert.Equal(t, "c", events[0].Payload)
+	})
+
+	t.Run("should broadcast new events to every subscriber", func(t *testing.T) {
+		log := NewEventLog(0)
+		log.Append("delta", "a")
+
+		first := log.Subscribe(0)
+		second := log.Subscribe(1)
+		assert.Len(t, first.Backlog(), 1)
+		assert.Empty(t, second.Backlog())
+
+		log.Append("delta", "b")
+		log.Close()
+
+		for _, sub := range []*Subscription{first, second} {
+			var payloads []any
+			for event := range sub.Events() {
+				payloads = append(payloads, event.Payload)
+			}
+			assert.Equal(t, []any{"b"}, payloads)
+			assert.NoError(t, sub.Err())
+		}
+	})
+
+	t.Run("should evict a subscriber that falls behind without holding up the others", func(t *testing.T) {
+		log := NewEventLog(2)
+		slow := log.Subscribe(0)
+		fast := log.Subscribe(0)
+
+		for _, payload := range []string{"a", "b", "c"} {
+			log.Append("delta", payload)
+			<-fast.Events()
+		}
+
+		var queued []any
+		for event := range slow.Events() {
+			queued = append(queued, event.Payload)
+		}
+		assert.Equal(t, []any{"a", "b"}, queued)
+		assert.ErrorIs(t, slow.Err(), ErrSubscriberEvicted)
+
+		log.Append("delta", "d")
+		event := <-fast.Events()
+		assert.Equal(t, "d", event.Payload)
+		assert.NoError(t, fast.Err())
+	})
+
+	t.Run("should stop queueing for closed subscriptions", func(t *testing.T) {
+		log := NewEventLog(1)
+		sub := log.Subscribe(0)
+		sub.Close()
+		sub.Close()
+
+		log.Append("delta", "a")
+		_, open := <-sub.Events()
+		assert.False(t, open)
+		assert.NoError(t, sub.Err())
+	})
+
+	t.Run("should only replay a closed log", func(t *testing.T) {
+		log := NewEventLog(0)
+		log.Append("delta", "a")
+		log.Close()
+
+		sub := log.Subscribe(0)
+		assert.Len(t, sub.Backlog(), 1)
+		_, open := <-sub.Events()
+		assert.False(t, open)
+	})
+}
+
+func TestGenerationSnapshot(t *testing.T) {
+	request := models.ChatRequest{Messages: []models.Message{{Role: "user", Content: "Hi there"}}}
+
+	t.Run("should report the answer so far while running", func(t *testing.T) {
+		service, _ := newTestGenerationService(&FakeProvider{ChunkDelay: 30 * time.Millisecond}, time.Minute)
+		gen := service.Start("u1", "msg_1", request)
+
+		assert.Eventually(t, func() bool { return gen.Snapshot().Content == "You " }, time.Second, 5*time.Millisecond)
+		snapshot := gen.Snapshot()
+		assert.Equal(t, GenerationRunning, snapshot.Status)
+		assert.Equal(t, int64(2), snapshot.LastEventId)
+		service.Cancel(gen.Id, "u1")
+	})
+
+	t.Run("should report how the generation ended", func(t *testing.T) {
+		service, _ := newTestGenerationService(NewFakeProvider(""), time.Minute)
+		gen := service.Start("u1", "msg_1", request)
+		waitForEvents(t, gen)
+
+		snapshot := gen.Snapshot()
+		assert.Equal(t, GenerationCompleted, snapshot.Status)
+		assert.Equal(t, "You said: Hi there", snapshot.Content)
+		assert.Equal(t, "stop", snapshot.FinishReason)
+		assert.NotNil(t, snapshot.Usage)
+
+		service, _ = newTestGenerationService(&FakeProvider{Err: ErrNoProviderAvailable}, time.Minute)
+		gen = service.Start("u1", "msg_1", request)
+		waitForEvents(t, gen)
+
+		snapshot = gen.Snapshot()
+		assert.Equal(t, GenerationFailed, snapshot.Status)
+		assert.Equal(t, "no_provider_available", snapshot.ErrorCode)
+	})
+}
@@ -1,23 +1,74 @@
 package services
 
 import (
+	"bff/models"
 	"bff/utils"
+	"fmt"
+	"slices"
 	"strings"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/aaaton/golem/v4"
 	"github.com/aaaton/golem/v4/dicts/en"
 )
 
 
+// Defaults for keywords added without a category, severity or action. They
+// block messages, as every keyword did before rules had actions.
+const (
+	DefaultKeywordCategory = "general"
+	DefaultKeywordSeverity = models.KeywordSeverityHigh
+	DefaultKeywordAction   = models.KeywordActionBlock
+)
+
+// keywordSeverities and keywordActions rank severities and actions, so the
+// strictest of several matched rules decides
+var keywordSeverities = map[string]int{
+	models.KeywordSeverityLow:    1,
+	models.KeywordSeverityMedium: 2,
+	models.KeywordSeverityHigh:   3,
+}
+
+var keywordActions = map[string]int{
+	models.KeywordActionWarn:   1,
+	models.KeywordActionFlag:   2,
+	models.KeywordActionRedact: 3,
+	models.KeywordActionReview: 4,
+	models.KeywordActionBlock:  5,
+}
+
+// actionVerdicts tells what becomes of a message the action is taken on
+var actionVerdicts = map[string]string{
+	"":                         models.VerdictApproved,
+	models.KeywordActionWarn:   models.VerdictWarned,
+	models.KeywordActionFlag:   models.VerdictFlagged,
+	models.KeywordActionRedact: models.VerdictRedacted,
+	models.KeywordActionReview: models.VerdictHeld,
+	models.KeywordActionBlock:  models.VerdictBlocked,
+}
+
+// KeywordService keeps the forbidden keywords and phrases, stored as their
+// lemmatized tokens joined by spaces, e.g. "credit card number".
 type KeywordService struct {
-	set        utils.Set
+	set utils.Set
+	// rules holds the rule of each keyword, and order the keywords in the
+	// order they were added
+	rules      map[string]models.KeywordRule
+	order      []string
 	mu         sync.Mutex
 	lemmatizer *golem.Lemmatizer
+	// normalizer undoes disguises like "sp@m" before lemmatizing, in both
+	// the keywords and the texts checked
+	normalizer *TextNormalizer
+	// matcher finds the keywords in a text, and is rebuilt when they change
+	matcher *phraseMatcher
+	// redactor masks the keywords of redact rules
+	redactor *Redactor
 }
 
 
-func NewKeywordService() (*KeywordService, error) {
+func NewKeywordService(normalizer *TextNormalizer, redactor *Redactor) (*KeywordService, error) {
 	lemmatizer, err := golem.New(en.New())
 	if err != nil {
 		return nil, err
@@ -25,20 +76,96 @@ func NewKeywordService() (*KeywordService, error) {
 
 	return &KeywordService{
 		set:        utils.NewSet(),
+		rules:      make(map[string]models.KeywordRule),
 		lemmatizer: lemmatizer,
+		normalizer: normalizer,
+		redactor:   redactor,
 	}, nil
 }
 
 
+// AddWords adds keywords, which may be phrases of several words, with the
+// default rule
 func (s *KeywordService) AddWords(words []string) {
+	// The defaults are always valid
+	s.AddRules(words, models.KeywordRule{})
+}
+
+
+// AddRules adds keywords with the category, severity and action of rule,
+// using the defaults for those left empty. Keywords added before keep their
+// rule ID but take the new settings.
+func (s *KeywordService) AddRules(words []string, rule models.KeywordRule) error {
+	rule, err := validateKeywordRule(rule)
+	if err != nil {
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	changed := false
 	for _, word := range words {
 
-		lemma := s.lemmatizer.Lemma(strings.ToLower(word))
-		s.set.Add(lemma)
+		_, lemmas := s.lemmatize(word)
+		if len(lemmas) == 0 {
+			continue
+		}
+
+		phrase := strings.Join(lemmas, " ")
+		rule.Keyword = phrase
+		if existing, exists := s.rules[phrase]; exists {
+			rule.Id = existing.Id
+		} else {
+			s.set.Add(phrase)
+			s.order = append(s.order, phrase)
+			rule.Id = fmt.Sprintf("rule_%d", len(s.order))
+			changed = true
+		}
+		s.rules[phrase] = rule
+	}
+
+	if changed {
+		s.rebuildMatcher()
+	}
+	return nil
+}
+
+
+// validateKeywordRule fills in the defaults of rule and checks its severity
+// and action
+func validateKeywordRule(rule models.KeywordRule) (models.KeywordRule, error) {
+	rule.Category = strings.ToLower(strings.TrimSpace(rule.Category))
+	if rule.Category == "" {
+		rule.Category = DefaultKeywordCategory
+	}
+	if rule.Severity == "" {
+		rule.Severity = DefaultKeywordSeverity
+	}
+	if rule.Action == "" {
+		rule.Action = DefaultKeywordAction
+	}
+
+	if _, exists := keywordSeverities[rule.Severity]; !exists {
+		return rule, fmt.Errorf("unknown severity %q, expected low, medium or high", rule.Severity)
+	}
+	if _, exists := keywordActions[rule.Action]; !exists {
+		return rule, fmt.Errorf("unknown action %q, expected warn, flag, redact, review or block", rule.Action)
+	}
+	return rule, nil
+}
+
+
+// GetRules returns the rules of all keywords in the order they were added
+func (s *KeywordService) GetRules() []models.KeywordRule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules := make([]models.KeywordRule, 0, len(s.order))
+	for _, phrase := range s.order {
+		rules = append(rules, s.rules[phrase])
 	}
+	return rules
 }
 
 
@@ -52,28 +179,138 @@ func (s *KeywordService) GetAllKeywords() []string {
 func (s *KeywordService) ContainsKeyword(word string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	lemma := s.lemmatizer.Lemma(strings.ToLower(word))
-	return s.set.Contains(lemma)
+	_, lemmas := s.lemmatize(word)
+	return s.set.Contains(strings.Join(lemmas, " "))
 }
 
 
-
-func (s *KeywordService) CheckTextForKeywords(text string) []string {
+// CheckTextForKeywords returns every occurrence of a keyword or phrase in
+// the text, in the order in which they end, with the words that matched
+// and how they were normalized
+func (s *KeywordService) CheckTextForKeywords(text string) []models.KeywordMatch {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	words := strings.Fields(strings.ToLower(text))
-	var foundKeywords []string
+	if s.matcher == nil {
+		return nil
+	}
 
-	for _, word := range words {
+	tokens, lemmas := s.lemmatize(text)
+	var matches []models.KeywordMatch
+	for _, match := range s.matcher.Match(lemmas) {
+		start, end := tokens[match.Start].Start, tokens[match.End-1].End
+		rule := s.rules[match.Phrase]
+		keywordMatch := models.KeywordMatch{
+			RuleId:    rule.Id,
+			Category:  rule.Category,
+			Severity:  rule.Severity,
+			Action:    rule.Action,
+			Keyword:   match.Phrase,
+			Text:      text[start:end],
+			Start:     start,
+			End:       end,
+			RuneStart: utf8.RuneCountInString(text[:start]),
+			RuneEnd:   utf8.RuneCountInString(text[:end]),
+		}
+
+		var steps stepSet
+		for i := match.Start; i < match.End; i++ {
+			keywordMatch.Tokens = append(keywordMatch.Tokens, models.MatchedToken{
+				Text:       text[tokens[i].Start:tokens[i].End],
+				Normalized: tokens[i].Text,
+				Lemma:      lemmas[i],
+			})
+			for _, step := range tokens[i].Steps {
+				steps |= stepBit(step)
+			}
+		}
+		keywordMatch.Normalization = steps.names()
+		if keywordMatch.Normalization == nil {
+			keywordMatch.Normalization = []string{}
+		}
+
+		matches = append(matches, keywordMatch)
+	}
+
+	return matches
+}
+
+
+// Moderate checks the text for keywords and decides what to do about it:
+// the strictest action of the matched rules applies. The keywords of redact
+// rules are masked in the RedactedText of the result.
+func (s *KeywordService) Moderate(text string) models.ModerationResult {
+	matches := s.CheckTextForKeywords(text)
+	result := Decide(matches)
+
+	var redact []models.KeywordMatch
+	for _, match := range matches {
+		if match.Action == models.KeywordActionRedact {
+			redact = append(redact, match)
+		}
+	}
+	if len(redact) > 0 {
+		result.RedactedText = s.redactor.Redact(text, redact)
+	}
+	return result
+}
 
-		cleanWord := strings.Trim(word, ".,!?;:\"'")
-		lemma := s.lemmatizer.Lemma(cleanWord)
 
-		if s.set.Contains(lemma) {
-			foundKeywords = append(foundKeywords, lemma)
+// Decide takes the strictest action and severity of the matched rules
+func Decide(matches []models.KeywordMatch) models.ModerationResult {
+	result := models.ModerationResult{
+		Categories:    []string{},
+		FoundKeywords: FoundKeywords(matches),
+		Matches:       matches,
+	}
+	if result.Matches == nil {
+		result.Matches = []models.KeywordMatch{}
+	}
+
+	for _, match := range matches {
+		if keywordActions[match.Action] > keywordActions[result.Action] {
+			result.Action = match.Action
+		}
+		if keywordSeverities[match.Severity] > keywordSeverities[result.Severity] {
+			result.Severity = match.Severity
+		}
+		if !slices.Contains(result.Categories, match.Category) {
+			result.Categories = append(result.Categories, match.Category)
 		}
 	}
+	result.Verdict = actionVerdicts[result.Action]
+	return result
+}
 
+
+// FoundKeywords lists the keywords of the matches
+func FoundKeywords(matches []models.KeywordMatch) []string {
+	foundKeywords := make([]string, 0, len(matches))
+	for _, match := range matches {
+		foundKeywords = append(foundKeywords, match.Keyword)
+	}
 	return foundKeywords
 }
+
+
+// lemmatize normalizes the text, splits it into words and returns them
+// along with their lemmas
+func (s *KeywordService) lemmatize(text string) ([]normalizedToken, []string) {
+	tokens := s.normalizer.Tokens(text)
+	lemmas := make([]string, len(tokens))
+	for i, token := range tokens {
+		lemmas[i] = s.lemmatizer.Lemma(token.Text)
+	}
+	return tokens, lemmas
+}
+
+
+// rebuildMatcher builds the automaton for the current keywords; s.mu must
+// be held
+func (s *KeywordService) rebuildMatcher() {
+	phrases := make([][]string, 0, s.set.Size())
+	for _, phrase := range s.set.Values() {
+		phrases = append(phrases, strings.Split(phrase, " "))
+	}
+	s.matcher = newPhraseMatcher(phrases)
+}
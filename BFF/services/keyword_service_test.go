@@ -1,6 +1,7 @@
 package services
 
 import (
+	"bff/models"
 	"bff/utils"
 	"testing"
 
@@ -16,6 +17,7 @@ func setupKeywordService(t *testing.T) *KeywordService {
 
 	return &KeywordService{
 		set:        utils.NewSet(), // Assuming utils.NewSet() exists
+		rules:      make(map[string]models.KeywordRule),
 		lemmatizer: lemmatizer,
 	}
 }
@@ -79,7 +81,7 @@ func TestCheckTextForKeywords(t *testing.T) {
 		service.AddWords([]string{"running", "cats", "swimming"})
 
 		text := "I love running! My cats are swimming, and dogs are barking."
-		foundKeywords := service.CheckTextForKeywords(text)
+		foundKeywords := FoundKeywords(service.CheckTextForKeywords(text))
 
 		// Should find lemmatized forms
 		assert.Contains(t, foundKeywords, "run")
@@ -93,13 +95,167 @@ func TestCheckTextForKeywords(t *testing.T) {
 		service.AddWords([]string{"running", "swimming"})
 
 		text := "The quick brown fox jumps over the lazy dog."
-		foundKeywords := service.CheckTextForKeywords(text)
+		foundKeywords := FoundKeywords(service.CheckTextForKeywords(text))
 
 		assert.Empty(t, foundKeywords)
 		assert.Len(t, foundKeywords, 0)
 
 		// Test with empty text
-		foundKeywords = service.CheckTextForKeywords("")
+		foundKeywords = FoundKeywords(service.CheckTextForKeywords(""))
 		assert.Empty(t, foundKeywords)
 	})
 }
+
+func TestPhraseKeywords(t *testing.T) {
+	t.Run("should match phrases on lemmatized word sequences", func(t *testing.T) {
+		service := setupKeywordService(t)
+		service.AddWords([]string{"credit card number", "Kill yourself"})
+
+		assert.Equal(t, []string{"credit card number"}, FoundKeywords(service.CheckTextForKeywords("What is your Credit Card Number?")))
+		assert.Equal(t, []string{"credit card number"}, FoundKeywords(service.CheckTextForKeywords("Send me the credit cards numbers.")))
+		assert.Equal(t, []string{"kill yourself"}, FoundKeywords(service.CheckTextForKeywords("Stop killing yourself over it")))
+		assert.True(t, service.ContainsKeyword("credit  cards  number"))
+	})
+
+	t.Run("should not match the words of a phrase on their own", func(t *testing.T) {
+		service := setupKeywordService(t)
+		service.AddWords([]string{"credit card number"})
+
+		assert.Empty(t, service.CheckTextForKeywords("My credit is good, but my card number is secret"))
+		assert.False(t, service.ContainsKeyword("credit"))
+	})
+
+	t.Run("should find phrases and single words together", func(t *testing.T) {
+		service := setupKeywordService(t)
+		service.AddWords([]string{"card", "credit card"})
+
+		found := FoundKeywords(service.CheckTextForKeywords("a credit card, another card"))
+		assert.Equal(t, []string{"credit card", "card", "card"}, found)
+		assert.ElementsMatch(t, []string{"card", "credit card"}, service.GetAllKeywords())
+	})
+
+	t.Run("should pick up keywords added later", func(t *testing.T) {
+		service := setupKeywordService(t)
+		assert.Empty(t, service.CheckTextForKeywords("credit card"))
+
+		service.AddWords([]string{"credit card"})
+		assert.Equal(t, []string{"credit card"}, FoundKeywords(service.CheckTextForKeywords("credit card")))
+
+		service.AddWords([]string{"  ", "!!"})
+		assert.Len(t, service.GetAllKeywords(), 1)
+	})
+}
+
+func TestObfuscatedKeywords(t *testing.T) {
+	service := setupKeywordService(t)
+	normalizer, err := NewTextNormalizer(NormalizationSteps)
+	require.NoError(t, err)
+	service.normalizer = normalizer
+	service.AddWords([]string{"spam", "credit card number"})
+
+	t.Run("should see through disguised keywords", func(t *testing.T) {
+		for _, text := range []string{"sp@m", "s p a m", "ѕpam", "sp\u200bam", "spám", "SPAMMING s.p.a.m"} {
+			assert.Contains(t, FoundKeywords(service.CheckTextForKeywords(text)), "spam", text)
+		}
+		assert.Equal(t, []string{"credit card number"}, FoundKeywords(service.CheckTextForKeywords("my cr3dit c@rd numb3r")))
+	})
+
+	t.Run("should report where the keyword is in the original text", func(t *testing.T) {
+		text := "Buy my ѕ p @ m, or my Crédit  Card number!"
+		matches := service.CheckTextForKeywords(text)
+		require.Len(t, matches, 2)
+
+		assert.Equal(t, "rule_1", matches[0].RuleId)
+		assert.Equal(t, "spam", matches[0].Keyword)
+		assert.Equal(t, "ѕ p @ m", matches[0].Text)
+		assert.Equal(t, matches[0].Text, text[matches[0].Start:matches[0].End])
+		assert.Equal(t, 7, matches[0].RuneStart)
+		assert.Equal(t, 14, matches[0].RuneEnd)
+		assert.Equal(t, []string{NormalizeConfusables, NormalizeLeetspeak, NormalizeSpacedLetters}, matches[0].Normalization)
+
+		assert.Equal(t, "rule_2", matches[1].RuleId)
+		assert.Equal(t, "credit card number", matches[1].Keyword)
+		assert.Equal(t, "Crédit  Card number", matches[1].Text)
+		assert.Equal(t, []string{NormalizeDiacritics}, matches[1].Normalization)
+		assert.Equal(t, []models.MatchedToken{
+			{Text: "Crédit", Normalized: "credit", Lemma: "credit"},
+			{Text: "Card", Normalized: "card", Lemma: "card"},
+			{Text: "number", Normalized: "number", Lemma: "number"},
+		}, matches[1].Tokens)
+	})
+
+	t.Run("should not report steps that left the keyword alone", func(t *testing.T) {
+		matches := service.CheckTextForKeywords("plain spam")
+		require.Len(t, matches, 1)
+		assert.Equal(t, "spam", matches[0].Text)
+		assert.Empty(t, matches[0].Normalization)
+	})
+}
+
+func TestKeywordRules(t *testing.T) {
+	t.Run("should give keywords the default rule", func(t *testing.T) {
+		service := setupKeywordService(t)
+		service.AddWords([]string{"spam"})
+
+		assert.Equal(t, []models.KeywordRule{
+			{Id: "rule_1", Keyword: "spam", Category: "general", Severity: "high", Action: "block"},
+		}, service.GetRules())
+	})
+
+	t.Run("should update the rule of a keyword added again", func(t *testing.T) {
+		service := setupKeywordService(t)
+		service.AddWords([]string{"spam", "credit card"})
+		require.NoError(t, service.AddRules([]string{"credit cards"}, models.KeywordRule{Category: " PII ", Severity: "medium", Action: "redact"}))
+
+		rules := service.GetRules()
+		require.Len(t, rules, 2)
+		assert.Equal(t, models.KeywordRule{Id: "rule_2", Keyword: "credit card", Category: "pii", Severity: "medium", Action: "redact"}, rules[1])
+	})
+
+	t.Run("should reject unknown severities and actions", func(t *testing.T) {
+		service := setupKeywordService(t)
+		assert.Error(t, service.AddRules([]string{"spam"}, models.KeywordRule{Severity: "extreme"}))
+		assert.Error(t, service.AddRules([]string{"spam"}, models.KeywordRule{Action: "delete"}))
+		assert.Empty(t, service.GetRules())
+	})
+
+	t.Run("should apply the strictest action of the matched rules", func(t *testing.T) {
+		service := setupKeywordService(t)
+		require.NoError(t, service.AddRules([]string{"acme"}, models.KeywordRule{Category: "competitor", Severity: "low", Action: "warn"}))
+		require.NoError(t, service.AddRules([]string{"password"}, models.KeywordRule{Category: "pii", Severity: "medium", Action: "review"}))
+		service.AddWords([]string{"idiot"})
+
+		result := service.Moderate("Nothing to see here")
+		assert.Equal(t, models.VerdictApproved, result.Verdict)
+		assert.Empty(t, result.Action)
+		assert.Empty(t, result.Matches)
+
+		result = service.Moderate("Acme is better")
+		assert.Equal(t, models.VerdictWarned, result.Verdict)
+		assert.Equal(t, "warn", result.Action)
+		assert.Equal(t, "competitor", result.Matches[0].Category)
+
+		result = service.Moderate("Acme wants your password")
+		assert.Equal(t, models.VerdictHeld, result.Verdict)
+		assert.Equal(t, "medium", result.Severity)
+		assert.Equal(t, []string{"competitor", "pii"}, result.Categories)
+
+		result = service.Moderate("Acme password, idiot")
+		assert.Equal(t, models.VerdictBlocked, result.Verdict)
+		assert.Equal(t, "high", result.Severity)
+		assert.Equal(t, []string{"acme", "password", "idiot"}, result.FoundKeywords)
+	})
+
+	t.Run("should mask the keywords of redact rules", func(t *testing.T) {
+		service := setupKeywordService(t)
+		require.NoError(t, service.AddRules([]string{"credit card number"}, models.KeywordRule{Category: "pii", Action: "redact"}))
+		require.NoError(t, service.AddRules([]string{"acme"}, models.KeywordRule{Action: "warn"}))
+
+		result := service.Moderate("Acme asked for my Credit Card Number.")
+		assert.Equal(t, models.VerdictRedacted, result.Verdict)
+		assert.Equal(t, "Acme asked for my [REDACTED].", result.RedactedText)
+
+		result = service.Moderate("Acme is better")
+		assert.Empty(t, result.RedactedText)
+	})
+}
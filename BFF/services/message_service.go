@@ -5,8 +5,13 @@ import (
 	"sync"
 )
 
+// maxHistoryTurns caps how many earlier question/answer pairs are replayed
+// to the model so long conversations don't grow the prompt without bound.
+const maxHistoryTurns = 20
+
 type MessageService struct {
 	messages  []models.MessageUserTable
+	responses map[string]models.AssistantResponse
 	charLimit int16
 	mu        sync.Mutex
 }
@@ -14,6 +19,7 @@ type MessageService struct {
 func NewMessageService() *MessageService {
 	return &MessageService{
 		messages:  make([]models.MessageUserTable, 0),
+		responses: make(map[string]models.AssistantResponse),
 		charLimit: 100,
 	}
 }
@@ -41,6 +47,148 @@ func (s *MessageService) GetMessageById(messageId string) (*models.MessageUserTa
 	}
 	return nil, false
 }
+
+// GetConversationOwner returns the user that started the conversation, or
+// false if no message has been stored under that conversation yet.
+func (s *MessageService) GetConversationOwner(conversationId string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, msg := range s.messages {
+		if msg.ConversationId == conversationId {
+			return msg.UserId, true
+		}
+	}
+	return "", false
+}
+
+// GetHeldMessages returns the messages waiting for a moderator, in the
+// order they were posted.
+func (s *MessageService) GetHeldMessages() []models.MessageUserTable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	held := make([]models.MessageUserTable, 0)
+	for _, msg := range s.messages {
+		if msg.Review == models.ReviewPending {
+			held = append(held, msg)
+		}
+	}
+	return held
+}
+
+// ReviewMessage records a moderator's decision on a held message, either
+// ReviewApproved, after which it can be answered, or ReviewRejected. It
+// returns false if the message doesn't exist or isn't waiting for review.
+func (s *MessageService) ReviewMessage(messageId string, review string) (*models.MessageUserTable, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.messages {
+		if s.messages[i].MessageId != messageId {
+			continue
+		}
+		if s.messages[i].Review != models.ReviewPending {
+			return nil, false
+		}
+		s.messages[i].Review = review
+		msg := s.messages[i]
+		return &msg, true
+	}
+	return nil, false
+}
+
+// SaveResponse stores the assistant reply for a message, replacing any
+// earlier reply. It returns false if the message doesn't exist.
+func (s *MessageService) SaveResponse(response models.AssistantResponse) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, msg := range s.messages {
+		if msg.MessageId == response.MessageId {
+			s.responses[response.MessageId] = response
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MessageService) GetResponse(messageId string) (*models.AssistantResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	response, exists := s.responses[messageId]
+	if !exists {
+		return nil, false
+	}
+	return &response, true
+}
+
+// GetMessagePairs returns every stored message together with the assistant
+// reply it received, in the order the messages were posted.
+func (s *MessageService) GetMessagePairs() []models.MessagePair {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pairs := make([]models.MessagePair, 0, len(s.messages))
+	for _, msg := range s.messages {
+		pair := models.MessagePair{Question: msg}
+		if response, exists := s.responses[msg.MessageId]; exists {
+			pair.Answer = &response
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+// BuildChatMessages assembles the earlier user and assistant turns of the
+// message's conversation, followed by the message itself. Blocked messages,
+// held ones a moderator has not approved and turns the model never answered
+// are left out; flagged and redacted ones are replayed, redacted as the
+// model saw them.
+func (s *MessageService) BuildChatMessages(message models.MessageUserTable) []models.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var history []models.MessagePair
+	for _, msg := range s.messages {
+		if msg.MessageId == message.MessageId {
+			break
+		}
+		if msg.ConversationId != message.ConversationId || msg.Moderation == models.KeywordActionBlock || msg.Review == models.ReviewPending || msg.Review == models.ReviewRejected {
+			continue
+		}
+		response, exists := s.responses[msg.MessageId]
+		if !exists || response.Content == "" || response.FinishReason == "error" {
+			continue
+		}
+		history = append(history, models.MessagePair{Question: msg, Answer: &response})
+	}
+
+	if len(history) > maxHistoryTurns {
+		history = history[len(history)-maxHistoryTurns:]
+	}
+
+	chatMessages := make([]models.Message, 0, len(history)*2+1)
+	for _, pair := range history {
+		chatMessages = append(chatMessages,
+			models.Message{Role: "user", Content: modelContent(pair.Question)},
+			models.Message{Role: "assistant", Content: pair.Answer.Content},
+		)
+	}
+
+	return append(chatMessages, models.Message{Role: "user", Content: modelContent(message)})
+}
+
+// modelContent is what the model gets of a user message: the redacted
+// version, if any
+func modelContent(message models.MessageUserTable) string {
+	if message.RedactedContent != "" {
+		return message.RedactedContent
+	}
+	return message.MessageContent
+}
+
 func (s *MessageService) SetCharLimit(newCharLimit int16) int16 {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"bff/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildChatMessages(t *testing.T) {
+	t.Run("should replay earlier turns of the same conversation", func(t *testing.T) {
+		service := NewMessageService()
+		service.AddMessage(models.MessageUserTable{MessageId: "m1", ConversationId: "c1", UserId: "u1", MessageContent: "What is Go?"})
+		service.SaveResponse(models.AssistantResponse{MessageId: "m1", Content: "A programming language.", FinishReason: "stop"})
+		service.AddMessage(models.MessageUserTable{MessageId: "m2", ConversationId: "c2", UserId: "u1", MessageContent: "Other chat"})
+		service.SaveResponse(models.AssistantResponse{MessageId: "m2", Content: "Other answer", FinishReason: "stop"})
+		current := models.MessageUserTable{MessageId: "m3", ConversationId: "c1", UserId: "u1", MessageContent: "Who made it?"}
+		service.AddMessage(current)
+
+		chatMessages := service.BuildChatMessages(current)
+
+		assert.Equal(t, []models.Message{
+			{Role: "user", Content: "What is Go?"},
+			{Role: "assistant", Content: "A programming language."},
+			{Role: "user", Content: "Who made it?"},
+		}, chatMessages)
+	})
+
+	t.Run("should skip blocked, held and unanswered turns", func(t *testing.T) {
+		service := NewMessageService()
+		service.AddMessage(models.MessageUserTable{MessageId: "m1", ConversationId: "c1", Flagged: true, Moderation: models.KeywordActionBlock, MessageContent: "bad"})
+		service.SaveResponse(models.AssistantResponse{MessageId: "m1", Content: "x", FinishReason: "stop"})
+		service.AddMessage(models.MessageUserTable{MessageId: "m5", ConversationId: "c1", Flagged: true, Moderation: models.KeywordActionReview, Review: models.ReviewPending, MessageContent: "held"})
+		service.SaveResponse(models.AssistantResponse{MessageId: "m5", Content: "y", FinishReason: "stop"})
+		service.AddMessage(models.MessageUserTable{MessageId: "m2", ConversationId: "c1", MessageContent: "never answered"})
+		service.AddMessage(models.MessageUserTable{MessageId: "m4", ConversationId: "c1", MessageContent: "failed"})
+		service.SaveResponse(models.AssistantResponse{MessageId: "m4", Content: "partial", FinishReason: "error"})
+		current := models.MessageUserTable{MessageId: "m3", ConversationId: "c1", MessageContent: "Hello"}
+		service.AddMessage(current)
+
+		chatMessages := service.BuildChatMessages(current)
+
+		assert.Equal(t, []models.Message{{Role: "user", Content: "Hello"}}, chatMessages)
+	})
+
+	t.Run("should send the redacted version of a message", func(t *testing.T) {
+		service := NewMessageService()
+		current := models.MessageUserTable{MessageId: "m1", ConversationId: "c1", MessageContent: "My card is 1234", RedactedContent: "My [REDACTED] is 1234"}
+		service.AddMessage(current)
+
+		chatMessages := service.BuildChatMessages(current)
+
+		assert.Equal(t, []models.Message{{Role: "user", Content: "My [REDACTED] is 1234"}}, chatMessages)
+	})
+}
+
+func TestReviewMessage(t *testing.T) {
+	service := NewMessageService()
+	service.AddMessage(models.MessageUserTable{MessageId: "m1", ConversationId: "c1", Moderation: models.KeywordActionReview, Review: models.ReviewPending, MessageContent: "held"})
+	service.SaveResponse(models.AssistantResponse{MessageId: "m1", Content: "Answer", FinishReason: "stop"})
+	service.AddMessage(models.MessageUserTable{MessageId: "m2", ConversationId: "c1", MessageContent: "Hello"})
+
+	held := service.GetHeldMessages()
+	assert.Len(t, held, 1)
+	assert.Equal(t, "m1", held[0].MessageId)
+
+	message, ok := service.ReviewMessage("m1", models.ReviewApproved)
+	assert.True(t, ok)
+	assert.Equal(t, models.ReviewApproved, message.Review)
+	assert.Empty(t, service.GetHeldMessages())
+
+	_, ok = service.ReviewMessage("m1", models.ReviewRejected)
+	assert.False(t, ok)
+	_, ok = service.ReviewMessage("m2", models.ReviewApproved)
+	assert.False(t, ok)
+	_, ok = service.ReviewMessage("missing", models.ReviewApproved)
+	assert.False(t, ok)
+
+	current := models.MessageUserTable{MessageId: "m3", ConversationId: "c1", MessageContent: "Next"}
+	service.AddMessage(current)
+	assert.Equal(t, []models.Message{
+		{Role: "user", Content: "held"},
+		{Role: "assistant", Content: "Answer"},
+		{Role: "user", Content: "Next"},
+	}, service.BuildChatMessages(current))
+}
+
+func TestGetMessagePairs(t *testing.T) {
+	service := NewMessageService()
+	service.AddMessage(models.MessageUserTable{MessageId: "m1", MessageContent: "Question"})
+	service.AddMessage(models.MessageUserTable{MessageId: "m2", MessageContent: "Unanswered"})
+
+	assert.True(t, service.SaveResponse(models.AssistantResponse{MessageId: "m1", Content: "Answer", Model: "gpt-4o-mini"}))
+	assert.False(t, service.SaveResponse(models.AssistantResponse{MessageId: "missing"}))
+
+	pairs := service.GetMessagePairs()
+
+	assert.Len(t, pairs, 2)
+	assert.Equal(t, "m1", pairs[0].Question.MessageId)
+	assert.Equal(t, "Answer", pairs[0].Answer.Content)
+	assert.Nil(t, pairs[1].Answer)
+}
+
+func TestGetConversationOwner(t *testing.T) {
+	service := NewMessageService()
+	service.AddMessage(models.MessageUserTable{MessageId: "m1", ConversationId: "c1", UserId: "u1"})
+
+	owner, exists := service.GetConversationOwner("c1")
+	assert.True(t, exists)
+	assert.Equal(t, "u1", owner)
+
+	_, exists = service.GetConversationOwner("missing")
+	assert.False(t, exists)
+}
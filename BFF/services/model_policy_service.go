@@ -0,0 +1,147 @@
+package services
+
+import (
+	"bff/models"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// General bounds that apply to every model, on top of its ModelLimits
+const (
+	defaultMaxTemperature = 2.0
+	maxStopSequences      = 4
+	minPenalty            = -2.0
+	maxPenalty            = 2.0
+)
+
+// ModelPolicyConfig describes the model answering messages that don't pick
+// one, so it isn't exempt from limits
+type ModelPolicyConfig struct {
+	// DefaultModel is the model the provider uses by default, if known. An
+	// empty model gets its limits when it is on the allowlist.
+	DefaultModel string
+	// MaxTokens caps maxTokens for models without a limit of their own,
+	// including the default model. Zero means no cap.
+	MaxTokens int
+}
+
+// ModelPolicyService keeps the admin-managed allowlist of models clients may
+// request and checks generation parameters against each model's limits.
+// An empty model always means the provider's configured default.
+type ModelPolicyService struct {
+	models map[string]models.ModelLimits
+	config ModelPolicyConfig
+	mu     sync.RWMutex
+}
+
+func NewModelPolicyService(allowedModels []string, config ModelPolicyConfig) *ModelPolicyService {
+	s := &ModelPolicyService{
+		models: make(map[string]models.ModelLimits),
+		config: config,
+	}
+	for _, model := range allowedModels {
+		s.models[model] = models.ModelLimits{Model: model}
+	}
+	return s
+}
+
+// SetModelLimits adds the model to the allowlist or replaces its limits
+func (s *ModelPolicyService) SetModelLimits(limits models.ModelLimits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.models[limits.Model] = limits
+}
+
+func (s *ModelPolicyService) RemoveModel(model string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.models[model]; !exists {
+		return false
+	}
+	delete(s.models, model)
+	return true
+}
+
+// GetAllowedModels returns the allowlist sorted by model name
+func (s *ModelPolicyService) GetAllowedModels() []models.ModelLimits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	allowed := make([]models.ModelLimits, 0, len(s.models))
+	for _, limits := range s.models {
+		allowed = append(allowed, limits)
+	}
+	sort.Slice(allowed, func(i, j int) bool {
+		return allowed[i].Model < allowed[j].Model
+	})
+	return allowed
+}
+
+// Validate reports the first reason the model or parameters can't be used
+func (s *ModelPolicyService) Validate(model string, params models.GenerationParams) error {
+	var limits models.ModelLimits
+	s.mu.RLock()
+	if model != "" {
+		allowed, exists := s.models[model]
+		if !exists {
+			s.mu.RUnlock()
+			return fmt.Errorf("model %q is not allowed", model)
+		}
+		limits = allowed
+	} else if s.config.DefaultModel != "" {
+		// The default model is always usable, but keeps its limits
+		limits = s.models[s.config.DefaultModel]
+		model = s.config.DefaultModel
+	}
+	s.mu.RUnlock()
+
+	if limits.MaxTokens == 0 {
+		limits.MaxTokens = s.config.MaxTokens
+	}
+
+	maxTemperature := defaultMaxTemperature
+	if limits.MaxTemperature > 0 {
+		maxTemperature = limits.MaxTemperature
+	}
+	if params.Temperature != nil && (*params.Temperature < 0 || *params.Temperature > maxTemperature) {
+		return fmt.Errorf("temperature must be between 0 and %g", maxTemperature)
+	}
+
+	if params.TopP != nil && (*params.TopP <= 0 || *params.TopP > 1) {
+		return fmt.Errorf("topP must be greater than 0 and at most 1")
+	}
+
+	if params.MaxTokens != nil {
+		if *params.MaxTokens <= 0 {
+			return fmt.Errorf("maxTokens must be positive")
+		}
+		if limits.MaxTokens > 0 && *params.MaxTokens > limits.MaxTokens {
+			if model == "" {
+				return fmt.Errorf("maxTokens must be at most %d", limits.MaxTokens)
+			}
+			return fmt.Errorf("maxTokens must be at most %d for model %q", limits.MaxTokens, model)
+		}
+	}
+
+	if len(params.Stop) > maxStopSequences {
+		return fmt.Errorf("at most %d stop sequences are allowed", maxStopSequences)
+	}
+	for _, stop := range params.Stop {
+		if stop == "" {
+			return fmt.Errorf("stop sequences cannot be empty")
+		}
+	}
+
+	for name, penalty := range map[string]*float64{
+		"presencePenalty":  params.PresencePenalty,
+		"frequencyPenalty": params.FrequencyPenalty,
+	} {
+		if penalty != nil && (*penalty < minPenalty || *penalty > maxPenalty) {
+			return fmt.Errorf("%s must be between %g and %g", name, minPenalty, maxPenalty)
+		}
+	}
+
+	return nil
+}
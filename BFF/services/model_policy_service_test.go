@@ -0,0 +1,69 @@
+package services
+
+import (
+	"bff/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func float(value float64) *float64 {
+	return &value
+}
+
+func integer(value int) *int {
+	return &value
+}
+
+func TestModelPolicyService(t *testing.T) {
+	t.Run("should only allow listed models", func(t *testing.T) {
+		service := NewModelPolicyService([]string{"gpt-4o-mini"}, ModelPolicyConfig{})
+
+		assert.NoError(t, service.Validate("", models.GenerationParams{}))
+		assert.NoError(t, service.Validate("gpt-4o-mini", models.GenerationParams{}))
+		assert.Error(t, service.Validate("gpt-4o", models.GenerationParams{}))
+
+		service.SetModelLimits(models.ModelLimits{Model: "gpt-4o"})
+		assert.NoError(t, service.Validate("gpt-4o", models.GenerationParams{}))
+
+		assert.True(t, service.RemoveModel("gpt-4o"))
+		assert.False(t, service.RemoveModel("gpt-4o"))
+		assert.Error(t, service.Validate("gpt-4o", models.GenerationParams{}))
+	})
+
+	t.Run("should enforce per-model limits", func(t *testing.T) {
+		service := NewModelPolicyService(nil, ModelPolicyConfig{})
+		service.SetModelLimits(models.ModelLimits{Model: "m", MaxTokens: 500, MaxTemperature: 1})
+
+		assert.NoError(t, service.Validate("m", models.GenerationParams{MaxTokens: integer(500), Temperature: float(1)}))
+		assert.Error(t, service.Validate("m", models.GenerationParams{MaxTokens: integer(501)}))
+		assert.Error(t, service.Validate("m", models.GenerationParams{Temperature: float(1.5)}))
+		assert.NoError(t, service.Validate("", models.GenerationParams{Temperature: float(1.5)}))
+	})
+
+	t.Run("should hold the default model to its limits", func(t *testing.T) {
+		service := NewModelPolicyService(nil, ModelPolicyConfig{DefaultModel: "gpt-4o-mini", MaxTokens: 4096})
+
+		assert.NoError(t, service.Validate("", models.GenerationParams{MaxTokens: integer(4096)}))
+		assert.Error(t, service.Validate("", models.GenerationParams{MaxTokens: integer(4097)}))
+
+		service.SetModelLimits(models.ModelLimits{Model: "gpt-4o-mini", MaxTokens: 500, MaxTemperature: 1})
+		assert.Error(t, service.Validate("", models.GenerationParams{MaxTokens: integer(501)}))
+		assert.Error(t, service.Validate("", models.GenerationParams{Temperature: float(1.5)}))
+
+		service.SetModelLimits(models.ModelLimits{Model: "gpt-4o"})
+		assert.Error(t, service.Validate("gpt-4o", models.GenerationParams{MaxTokens: integer(4097)}))
+	})
+
+	t.Run("should reject out-of-range parameters", func(t *testing.T) {
+		service := NewModelPolicyService(nil, ModelPolicyConfig{})
+
+		assert.Error(t, service.Validate("", models.GenerationParams{TopP: float(0)}))
+		assert.Error(t, service.Validate("", models.GenerationParams{MaxTokens: integer(0)}))
+		assert.Error(t, service.Validate("", models.GenerationParams{PresencePenalty: float(2.5)}))
+		assert.Error(t, service.Validate("", models.GenerationParams{FrequencyPenalty: float(-3)}))
+		assert.Error(t, service.Validate("", models.GenerationParams{Stop: []string{"a", "b", "c", "d", "e"}}))
+		assert.Error(t, service.Validate("", models.GenerationParams{Stop: []string{""}}))
+		assert.NoError(t, service.Validate("", models.GenerationParams{Seed: integer(42), Stop: []string{"END"}}))
+	})
+}
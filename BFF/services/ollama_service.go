@@ -0,0 +1,238 @@
+package services
+
+import (
+	"bff/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultOllamaBaseURL = "http://localhost:11434"
+	defaultOllamaModel   = "llama3.2"
+)
+
+// OllamaService talks to a local Ollama server through its native /api/chat
+// endpoint, which streams newline-delimited JSON instead of SSE.
+type OllamaService struct {
+	apiKey  string
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+func NewOllamaService(config ProviderConfig) *OllamaService {
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = defaultOllamaBaseURL
+	}
+	model := config.Model
+	if model == "" {
+		model = defaultOllamaModel
+	}
+
+	return &OllamaService{
+		apiKey:  config.APIKey,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		model:   model,
+		client:  newHTTPClient(config.ConnectTimeout),
+	}
+}
+
+func (s *OllamaService) Name() string {
+	return "ollama"
+}
+
+func (s *OllamaService) StreamCompletion(ctx context.Context, request models.ChatRequest, responseChan chan<- models.StreamChunk, errorChan chan<- error) {
+	defer close(responseChan)
+	defer close(errorChan)
+
+	req, err := s.newChatRequest(ctx, request, true)
+	if err != nil {
+		errorChan <- err
+		return
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		errorChan <- newConnectionError(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errorChan <- newStatusError("Ollama", resp)
+		return
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var line models.OllamaResponse
+		if err := decoder.Decode(&line); err != nil {
+			if err == io.EOF {
+				// Without a done line the answer was cut off
+				err = io.ErrUnexpectedEOF
+			}
+			errorChan <- &UpstreamError{
+				Message:   fmt.Sprintf("error reading stream: %v", err),
+				Retryable: true,
+				Err:       err,
+			}
+			return
+		}
+
+		if line.Error != "" {
+			errorChan <- ollamaError("Ollama stream error", line.Error)
+			return
+		}
+
+		if line.Message.Content != "" {
+			if !sendChunk(ctx, responseChan, models.StreamChunk{Content: line.Message.Content, Model: line.Model}) {
+				errorChan <- ctx.Err()
+				return
+			}
+		}
+
+		if line.Done {
+			chunk := models.StreamChunk{
+				FinishReason: ollamaFinishReason(line.DoneReason),
+				Model:        line.Model,
+				Usage:        models.NewUsage(line.PromptEvalCount, line.EvalCount),
+			}
+			if !sendChunk(ctx, responseChan, chunk) {
+				errorChan <- ctx.Err()
+				return
+			}
+			return
+		}
+	}
+}
+
+func (s *OllamaService) Complete(ctx context.Context, request models.ChatRequest) (*models.ChatResponse, error) {
+	req, err := s.newChatRequest(ctx, request, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, newConnectionError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError("Ollama", resp)
+	}
+
+	var completion models.OllamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if completion.Error != "" {
+		return nil, ollamaError("Ollama API error", completion.Error)
+	}
+
+	return &models.ChatResponse{
+		Content:      completion.Message.Content,
+		FinishReason: ollamaFinishReason(completion.DoneReason),
+		Model:        completion.Model,
+		Usage:        models.NewUsage(completion.PromptEvalCount, completion.EvalCount),
+	}, nil
+}
+
+// ValidateAPIKey checks that the Ollama server is reachable. Ollama has no
+// keys of its own, but one is forwarded when it sits behind an auth proxy.
+func (s *OllamaService) ValidateAPIKey() error {
+	ctx, cancel := context.WithTimeout(context.Background(), validateAPIKeyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL+"/api/tags", nil)
+	if err != nil {
+		return err
+	}
+	s.setHeaders(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errors.New("invalid Ollama API key")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Ollama API error: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (s *OllamaService) newChatRequest(ctx context.Context, request models.ChatRequest, stream bool) (*http.Request, error) {
+	model := request.Model
+	if model == "" {
+		model = s.model
+	}
+
+	requestBody := models.OllamaRequest{
+		Model:    model,
+		Messages: request.Messages,
+		Stream:   stream,
+		Options: models.OllamaOptions{
+			Temperature:      request.Params.Temperature,
+			TopP:             request.Params.TopP,
+			NumPredict:       request.Params.MaxTokens,
+			Stop:             request.Params.Stop,
+			Seed:             request.Params.Seed,
+			PresencePenalty:  request.Params.PresencePenalty,
+			FrequencyPenalty: request.Params.FrequencyPenalty,
+		},
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.baseURL+"/api/chat", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	s.setHeaders(req)
+
+	return req, nil
+}
+
+func (s *OllamaService) setHeaders(req *http.Request) {
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+}
+
+// ollamaError turns an error sent after a 200 into an UpstreamError. Ollama
+// reports a missing model this way, which is not worth retrying; anything
+// else is the server or its model runner failing.
+func ollamaError(prefix string, message string) *UpstreamError {
+	return &UpstreamError{
+		Message:   fmt.Sprintf("%s: %s", prefix, message),
+		Retryable: !strings.Contains(message, "not found"),
+	}
+}
+
+// ollamaFinishReason defaults to "stop" for older Ollama versions that don't
+// report done_reason.
+func ollamaFinishReason(doneReason string) string {
+	if doneReason == "" {
+		return "stop"
+	}
+	return doneReason
+}
@@ -2,141 +2,253 @@ package services
 
 import (
 	"bff/models"
-	"bufio"
+	"bff/sse"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
-	"time"
+)
+
+
+const (
+	defaultOpenAIBaseURL = "https://api.openai.com/v1"
+	defaultOpenAIModel   = "gpt-4o-mini"
 )
 
 
 type OpenAIService struct {
-	apiKey  string
-	baseURL string
-	client  *http.Client
+	apiKey      string
+	baseURL     string
+	model       string
+	streamUsage bool
+	client      *http.Client
 }
 
 
-func NewOpenAIService(apiKey string) *OpenAIService {
+func NewOpenAIService(config ProviderConfig) *OpenAIService {
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	model := config.Model
+	if model == "" {
+		model = defaultOpenAIModel
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	// Older vLLM and llama.cpp servers and Ollama's /v1 reject or mishandle
+	// stream_options
+	streamUsage := baseURL == defaultOpenAIBaseURL
+	if config.StreamUsage != nil {
+		streamUsage = *config.StreamUsage
+	}
+
 	return &OpenAIService{
-		apiKey:  apiKey,
-		baseURL: "https://api.openai.com/v1",
-		client: &http.Client{
-			Timeout: 60 * time.Second,
-		},
+		apiKey:      config.APIKey,
+		baseURL:     baseURL,
+		model:       model,
+		streamUsage: streamUsage,
+		client:      newHTTPClient(config.ConnectTimeout),
 	}
 }
 
 
-func (s *OpenAIService) StreamCompletion(userMessage string, responseChan chan<- string, errorChan chan<- error) {
+func (s *OpenAIService) Name() string {
+	return "openai"
+}
+
+
+func (s *OpenAIService) StreamCompletion(ctx context.Context, request models.ChatRequest, responseChan chan<- models.StreamChunk, errorChan chan<- error) {
 	defer close(responseChan)
 	defer close(errorChan)
 
 
-	requestBody := models.OpenAIRequest{
-		Model: "gpt-4o-mini", // You can change this to gpt-4 if needed
-		Messages: []models.Message{
-			{
-				Role: "assistant",
-				Content: `Task Instructions:
-You will be provided with a question from the user, and you need to provide an answer based on the data provided.
-If the question can be answered with the data provided, you should provide a direct answer.
-If the question requires reasoning or analysis, you should provide a detailed explanation of your reasoning process and the steps you took to arrive at your answer.
-Your answer should always be structured and use fun emojis.`,
-			},
-			{
-				Role:    "user",
-				Content: userMessage,
-			},
-		},
-		Stream: true,
+	req, err := s.newChatRequest(ctx, request, true)
+	if err != nil {
+		errorChan <- err
+		return
 	}
 
-	jsonData, err := json.Marshal(requestBody)
+
+	resp, err := s.client.Do(req)
 	if err != nil {
-		errorChan <- fmt.Errorf("failed to marshal request: %w", err)
+		errorChan <- newConnectionError(err)
 		return
 	}
+	defer resp.Body.Close()
 
 
-	req, err := http.NewRequest("POST", s.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		errorChan <- fmt.Errorf("failed to create request: %w", err)
+	if resp.StatusCode != http.StatusOK {
+		errorChan <- newStatusError("OpenAI", resp)
 		return
 	}
 
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	reader := sse.NewReader(resp.Body)
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			errorChan <- fmt.Errorf("error reading stream: %w", err)
+			return
+		}
+
+
+		if event.Data == "[DONE]" {
+			return
+		}
+
+
+		var streamResp models.OpenAIStreamResponse
+		if err := event.Decode(&streamResp); err != nil {
+			errorChan <- err
+			return
+		}
+
+
+		if streamResp.Error != nil {
+			errorChan <- openAIStreamError(streamResp.Error)
+			return
+		}
+
+
+		chunk := models.StreamChunk{Model: streamResp.Model}
+		if len(streamResp.Choices) > 0 {
+			choice := streamResp.Choices[0]
+			chunk.Content = choice.Delta.Content
+			if choice.FinishReason != nil {
+				chunk.FinishReason = *choice.FinishReason
+			}
+		}
+		if streamResp.Usage != nil {
+			chunk.Usage = models.NewUsage(streamResp.Usage.PromptTokens, streamResp.Usage.CompletionTokens)
+		}
 
 
+		if chunk.Content != "" || chunk.FinishReason != "" || chunk.Usage != nil {
+			if !sendChunk(ctx, responseChan, chunk) {
+				errorChan <- ctx.Err()
+				return
+			}
+		}
+	}
+}
+
+
+func (s *OpenAIService) Complete(ctx context.Context, request models.ChatRequest) (*models.ChatResponse, error) {
+	req, err := s.newChatRequest(ctx, request, false)
+	if err != nil {
+		return nil, err
+	}
+
 	resp, err := s.client.Do(req)
 	if err != nil {
-		errorChan <- fmt.Errorf("failed to make request: %w", err)
-		return
+		return nil, newConnectionError(err)
 	}
 	defer resp.Body.Close()
 
-
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		errorChan <- fmt.Errorf("OpenAI API error: %d - %s", resp.StatusCode, string(body))
-		return
+		return nil, newStatusError("OpenAI", resp)
 	}
 
+	var completion models.OpenAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
 
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		line := scanner.Text()
+	if len(completion.Choices) == 0 {
+		return nil, errors.New("OpenAI API returned no choices")
+	}
 
-		// Skip empty lines
-		if line == "" {
-			continue
-		}
+	response := &models.ChatResponse{
+		Content:      completion.Choices[0].Message.Content,
+		FinishReason: completion.Choices[0].FinishReason,
+		Model:        completion.Model,
+	}
+	if completion.Usage != nil {
+		response.Usage = models.NewUsage(completion.Usage.PromptTokens, completion.Usage.CompletionTokens)
+	}
 
+	return response, nil
+}
 
-		if strings.HasPrefix(line, "data: ") {
-			data := strings.TrimPrefix(line, "data: ")
 
+// newChatRequest builds the /chat/completions call for the given request,
+// falling back to the configured model.
+func (s *OpenAIService) newChatRequest(ctx context.Context, request models.ChatRequest, stream bool) (*http.Request, error) {
+	model := request.Model
+	if model == "" {
+		model = s.model
+	}
 
-			if data == "[DONE]" {
-				break
-			}
+	requestBody := models.OpenAIRequest{
+		Model:            model,
+		Messages:         request.Messages,
+		Stream:           stream,
+		Temperature:      request.Params.Temperature,
+		TopP:             request.Params.TopP,
+		MaxTokens:        request.Params.MaxTokens,
+		Stop:             request.Params.Stop,
+		Seed:             request.Params.Seed,
+		PresencePenalty:  request.Params.PresencePenalty,
+		FrequencyPenalty: request.Params.FrequencyPenalty,
+	}
+	if stream && s.streamUsage {
+		requestBody.StreamOptions = &models.OpenAIStreamOptions{IncludeUsage: true}
+	}
 
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
 
-			var streamResp models.OpenAIStreamResponse
-			if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
+	req.Header.Set("Content-Type", "application/json")
+	s.setHeaders(req)
 
-				continue
-			}
+	return req, nil
+}
 
 
-			if len(streamResp.Choices) > 0 {
-				content := streamResp.Choices[0].Delta.Content
-				if content != "" {
-					responseChan <- content
-				}
-			}
-		}
+// openAIStreamError turns an error object received after a 200 into an
+// UpstreamError. Server-side failures are worth retrying, bad requests are not.
+func openAIStreamError(streamErr *models.OpenAIError) *UpstreamError {
+	return &UpstreamError{
+		Message:   fmt.Sprintf("OpenAI stream error: %s - %s", streamErr.Type, streamErr.Message),
+		Retryable: streamErr.Type == "server_error" || streamErr.Type == "rate_limit_exceeded",
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		errorChan <- fmt.Errorf("error reading stream: %w", err)
+
+// setHeaders adds the bearer token. OpenAI-compatible servers such as
+// llama.cpp or vLLM often run without a key, in which case none is sent.
+func (s *OpenAIService) setHeaders(req *http.Request) {
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
 	}
 }
 
 
 func (s *OpenAIService) ValidateAPIKey() error {
-	req, err := http.NewRequest("GET", s.baseURL+"/models", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), validateAPIKeyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL+"/models", nil)
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	s.setHeaders(req)
 
 	resp, err := s.client.Do(req)
 	if err != nil {
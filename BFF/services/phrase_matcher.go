@@ -0,0 +1,109 @@
+package services
+
+import "strings"
+
+// phraseMatch is one occurrence of a phrase, spanning the tokens from
+// Start up to but not including End
+type phraseMatch struct {
+	Phrase string
+	Start  int
+	End    int
+}
+
+// phraseMatcher is an Aho-Corasick automaton over token sequences. It
+// finds every occurrence of its phrases in a single pass over the tokens,
+// so scanning stays linear in the length of the text however many phrases
+// there are.
+type phraseMatcher struct {
+	nodes   []phraseNode
+	phrases []string
+	lengths []int
+}
+
+type phraseNode struct {
+	next map[string]int
+	// fail is the node of the longest proper suffix of this node's path
+	// that is also a path from the root
+	fail int
+	// outputs are the phrases ending here, including those of the fail
+	// chain, longest first
+	outputs []int
+}
+
+// newPhraseMatcher builds the automaton for phrases given as their tokens.
+// The text of a phrase is its tokens joined by spaces.
+func newPhraseMatcher(phrases [][]string) *phraseMatcher {
+	m := &phraseMatcher{nodes: []phraseNode{{next: make(map[string]int)}}}
+
+	for _, tokens := range phrases {
+		if len(tokens) == 0 {
+			continue
+		}
+
+		node := 0
+		for _, token := range tokens {
+			child, exists := m.nodes[node].next[token]
+			if !exists {
+				child = len(m.nodes)
+				m.nodes = append(m.nodes, phraseNode{next: make(map[string]int)})
+				m.nodes[node].next[token] = child
+			}
+			node = child
+		}
+
+		m.nodes[node].outputs = append(m.nodes[node].outputs, len(m.phrases))
+		m.phrases = append(m.phrases, strings.Join(tokens, " "))
+		m.lengths = append(m.lengths, len(tokens))
+	}
+
+	// Fail links are set breadth first, since a node's link always points
+	// to a shallower node. Children of the root fail to the root.
+	queue := make([]int, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		for token, child := range m.nodes[node].next {
+			m.nodes[child].fail = m.step(m.nodes[node].fail, token)
+			m.nodes[child].outputs = append(m.nodes[child].outputs, m.nodes[m.nodes[child].fail].outputs...)
+			queue = append(queue, child)
+		}
+	}
+	return m
+}
+
+// Match returns every occurrence of the phrases in tokens, ordered by
+// where they end
+func (m *phraseMatcher) Match(tokens []string) []phraseMatch {
+	var matches []phraseMatch
+
+	node := 0
+	for i, token := range tokens {
+		node = m.step(node, token)
+		for _, phrase := range m.nodes[node].outputs {
+			matches = append(matches, phraseMatch{
+				Phrase: m.phrases[phrase],
+				Start:  i + 1 - m.lengths[phrase],
+				End:    i + 1,
+			})
+		}
+	}
+	return matches
+}
+
+// step follows token from node, falling back along the fail links until
+// some node has a transition for it, or the root is reached
+func (m *phraseMatcher) step(node int, token string) int {
+	for {
+		if child, exists := m.nodes[node].next[token]; exists {
+			return child
+		}
+		if node == 0 {
+			return 0
+		}
+		node = m.nodes[node].fail
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhraseMatcher(t *testing.T) {
+	t.Run("should find overlapping and nested phrases", func(t *testing.T) {
+		matcher := newPhraseMatcher([][]string{
+			{"a", "b", "c"},
+			{"b", "c", "d"},
+			{"c"},
+		})
+
+		matches := matcher.Match(strings.Fields("x a b c d"))
+		assert.Equal(t, []phraseMatch{
+			{Phrase: "a b c", Start: 1, End: 4},
+			{Phrase: "c", Start: 3, End: 4},
+			{Phrase: "b c d", Start: 2, End: 5},
+		}, matches)
+	})
+
+	t.Run("should recover from partial matches through fail links", func(t *testing.T) {
+		matcher := newPhraseMatcher([][]string{
+			{"kill", "you"},
+			{"you", "are", "kill"},
+		})
+
+		matches := matcher.Match(strings.Fields("kill kill you are kill you"))
+		assert.Equal(t, []phraseMatch{
+			{Phrase: "kill you", Start: 1, End: 3},
+			{Phrase: "you are kill", Start: 2, End: 5},
+			{Phrase: "kill you", Start: 4, End: 6},
+		}, matches)
+	})
+
+	t.Run("should match nothing without phrases or tokens", func(t *testing.T) {
+		assert.Empty(t, newPhraseMatcher(nil).Match(strings.Fields("a b")))
+		assert.Empty(t, newPhraseMatcher([][]string{{"a"}, {}}).Match(nil))
+	})
+}
+
+// BenchmarkPhraseMatcher scans the same message against growing rule
+// lists; the time per scan should stay about the same
+func BenchmarkPhraseMatcher(b *testing.B) {
+	text := strings.Fields(strings.Repeat("please send me your credit card number and the code on the back ", 20))
+
+	for _, rules := range []int{10, 1000, 100000} {
+		phrases := [][]string{{"credit", "card", "number"}}
+		for i := range rules {
+			phrases = append(phrases, []string{fmt.Sprintf("word%d", i), "card", fmt.Sprintf("rule%d", i)})
+		}
+		matcher := newPhraseMatcher(phrases)
+
+		b.Run(fmt.Sprintf("%d rules", rules), func(b *testing.B) {
+			for b.Loop() {
+				matcher.Match(text)
+			}
+		})
+	}
+}
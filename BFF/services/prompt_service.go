@@ -0,0 +1,189 @@
+package services
+
+import (
+	"bff/models"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultPromptTemplate = "default"
+	promptTemplateExt     = ".tmpl"
+)
+
+// ErrUnknownPromptTemplate is returned for a template that is not loaded,
+// e.g. one a reload removed after a message named it
+var ErrUnknownPromptTemplate = errors.New("unknown prompt template")
+
+// builtinDefaultPrompt is used when the templates directory doesn't provide
+// its own default.tmpl
+const builtinDefaultPrompt = `You are a helpful assistant{{if .UserName}} talking to {{.UserName}}{{end}}. Today's date is {{.Date}}.
+{{- if .Locale}}
+Reply in the language of the {{.Locale}} locale.
+{{- end}}
+If the question requires reasoning or analysis, explain your reasoning and the steps you took to arrive at your answer.
+{{- if .Context}}
+
+Use the following context to answer the question:
+
+{{.Context}}
+{{- end}}`
+
+// promptData holds the variables available inside a template
+type promptData struct {
+	UserName string
+	Locale   string
+	Date     string
+	Context  string
+}
+
+// PromptService renders system prompts from named text/template files. The
+// templates are read from dir on startup and again on every Reload.
+type PromptService struct {
+	dir           string
+	templates     map[string]*template.Template
+	userTemplates map[string]string
+	mu            sync.RWMutex
+}
+
+func NewPromptService(dir string) (*PromptService, error) {
+	s := &PromptService{
+		dir:           dir,
+		userTemplates: make(map[string]string),
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload re-reads every *.tmpl file in the templates directory. A missing
+// directory leaves only the built-in default; a broken template fails the
+// reload and keeps the previous set in place. Users whose default template
+// is gone fall back to "default".
+func (s *PromptService) Reload() error {
+	templates := map[string]*template.Template{
+		defaultPromptTemplate: template.Must(template.New(defaultPromptTemplate).Parse(builtinDefaultPrompt)),
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+promptTemplateExt))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read prompt template %s: %w", file, err)
+		}
+
+		name := strings.TrimSuffix(filepath.Base(file), promptTemplateExt)
+		tmpl, err := template.New(name).Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("failed to parse prompt template %s: %w", file, err)
+		}
+		templates[name] = tmpl
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.templates = templates
+	for userId, name := range s.userTemplates {
+		if _, exists := templates[name]; !exists {
+			delete(s.userTemplates, userId)
+		}
+	}
+	return nil
+}
+
+// GetTemplateNames returns the names of all loaded templates, sorted
+func (s *PromptService) GetTemplateNames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.templates))
+	for name := range s.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *PromptService) HasTemplate(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, exists := s.templates[name]
+	return exists
+}
+
+// SetUserTemplate makes name the template used for the user's messages when
+// they don't pick one themselves.
+func (s *PromptService) SetUserTemplate(userId string, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.templates[name]; !exists {
+		return fmt.Errorf("%w %q", ErrUnknownPromptTemplate, name)
+	}
+	s.userTemplates[userId] = name
+	return nil
+}
+
+func (s *PromptService) GetUserTemplate(userId string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if name, exists := s.userTemplates[userId]; exists {
+		return name
+	}
+	return defaultPromptTemplate
+}
+
+// Render builds the system prompt for a user's message. The template named
+// in options wins over the user's default, which wins over "default".
+func (s *PromptService) Render(userId string, options models.PromptOptions) (string, error) {
+	name := options.Template
+	if name == "" {
+		name = s.GetUserTemplate(userId)
+	}
+
+	s.mu.RLock()
+	tmpl, exists := s.templates[name]
+	s.mu.RUnlock()
+	if !exists {
+		return "", fmt.Errorf("%w %q", ErrUnknownPromptTemplate, name)
+	}
+
+	data := promptData{
+		UserName: options.UserName,
+		Locale:   options.Locale,
+		Date:     time.Now().Format("Monday, January 2, 2006"),
+		Context:  options.Context,
+	}
+
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %q: %w", name, err)
+	}
+	return strings.TrimSpace(prompt.String()), nil
+}
+
+// NewChatRequest prefixes the conversation with the system prompt every
+// provider is given.
+func NewChatRequest(systemPrompt string, chatMessages []models.Message) models.ChatRequest {
+	return models.ChatRequest{
+		Messages: append([]models.Message{
+			{
+				Role:    "system",
+				Content: systemPrompt,
+			},
+		}, chatMessages...),
+	}
+}
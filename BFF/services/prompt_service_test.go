@@ -0,0 +1,107 @@
+package services
+
+import (
+	"bff/models"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTemplate(t *testing.T, dir string, name string, content string) {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+promptTemplateExt), []byte(content), 0o644))
+}
+
+func TestPromptService(t *testing.T) {
+	t.Run("should fall back to the built-in default without a directory", func(t *testing.T) {
+		service, err := NewPromptService(filepath.Join(t.TempDir(), "missing"))
+		require.NoError(t, err)
+
+		prompt, err := service.Render("u1", models.PromptOptions{UserName: "Ada", Context: "Go was released in 2009."})
+
+		require.NoError(t, err)
+		assert.Contains(t, prompt, "talking to Ada")
+		assert.Contains(t, prompt, "Go was released in 2009.")
+		assert.Equal(t, []string{"default"}, service.GetTemplateNames())
+	})
+
+	t.Run("should load the templates shipped with the BFF", func(t *testing.T) {
+		service, err := NewPromptService("../prompts")
+		require.NoError(t, err)
+
+		for _, name := range service.GetTemplateNames() {
+			_, err := service.Render("u1", models.PromptOptions{Template: name, UserName: "Ada", Locale: "fr-FR", Context: "ctx"})
+			assert.NoError(t, err, name)
+		}
+	})
+
+	t.Run("should pick the message template over the user's default", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "pirate", "Talk like a pirate in {{.Locale}}.")
+		writeTemplate(t, dir, "formal", "Be formal.")
+		service, err := NewPromptService(dir)
+		require.NoError(t, err)
+
+		require.NoError(t, service.SetUserTemplate("u1", "formal"))
+		assert.Error(t, service.SetUserTemplate("u1", "missing"))
+
+		prompt, err := service.Render("u1", models.PromptOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "Be formal.", prompt)
+
+		prompt, err = service.Render("u1", models.PromptOptions{Template: "pirate", Locale: "en-GB"})
+		require.NoError(t, err)
+		assert.Equal(t, "Talk like a pirate in en-GB.", prompt)
+
+		_, err = service.Render("u1", models.PromptOptions{Template: "missing"})
+		assert.Error(t, err)
+	})
+
+	t.Run("should drop user defaults whose template a reload removed", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "formal", "Be formal.")
+		service, err := NewPromptService(dir)
+		require.NoError(t, err)
+		require.NoError(t, service.SetUserTemplate("u1", "formal"))
+
+		require.NoError(t, os.Remove(filepath.Join(dir, "formal"+promptTemplateExt)))
+		require.NoError(t, service.Reload())
+
+		assert.Equal(t, "default", service.GetUserTemplate("u1"))
+		_, err = service.Render("u1", models.PromptOptions{})
+		assert.NoError(t, err)
+		_, err = service.Render("u1", models.PromptOptions{Template: "formal"})
+		assert.ErrorIs(t, err, ErrUnknownPromptTemplate)
+	})
+
+	t.Run("should pick up edited templates on reload", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "default", "First version.")
+		service, err := NewPromptService(dir)
+		require.NoError(t, err)
+
+		writeTemplate(t, dir, "default", "Second version.")
+		writeTemplate(t, dir, "broken", "{{.Unclosed")
+		assert.Error(t, service.Reload())
+
+		prompt, _ := service.Render("u1", models.PromptOptions{})
+		assert.Equal(t, "First version.", prompt)
+
+		require.NoError(t, os.Remove(filepath.Join(dir, "broken"+promptTemplateExt)))
+		require.NoError(t, service.Reload())
+
+		prompt, _ = service.Render("u1", models.PromptOptions{})
+		assert.Equal(t, "Second version.", prompt)
+	})
+}
+
+func TestNewChatRequest(t *testing.T) {
+	request := NewChatRequest("Be nice", []models.Message{{Role: "user", Content: "Hi"}})
+
+	assert.Equal(t, []models.Message{
+		{Role: "system", Content: "Be nice"},
+		{Role: "user", Content: "Hi"},
+	}, request.Messages)
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"bff/models"
+	"context"
+	"fmt"
+	"time"
+)
+
+// Provider is implemented by every LLM backend the BFF can talk to. The
+// handlers only depend on this interface, so vendors can be swapped through
+// configuration.
+type Provider interface {
+	// Name identifies the provider, e.g. "openai" or "anthropic"
+	Name() string
+
+	// StreamCompletion streams the reply into responseChan and reports
+	// failures on errorChan. Both channels are closed when it returns.
+	// Cancelling ctx aborts the upstream request and reports ctx.Err().
+	StreamCompletion(ctx context.Context, request models.ChatRequest, responseChan chan<- models.StreamChunk, errorChan chan<- error)
+
+	// Complete returns the whole reply in one response
+	Complete(ctx context.Context, request models.ChatRequest) (*models.ChatResponse, error)
+
+	// ValidateAPIKey checks the configured credentials against the backend
+	ValidateAPIKey() error
+}
+
+// ProviderConfig selects and configures the Provider built by NewProvider
+type ProviderConfig struct {
+	Provider       string
+	APIKey         string
+	BaseURL        string
+	Model          string
+	ConnectTimeout time.Duration
+	// StreamUsage asks OpenAI-compatible backends for token usage at the
+	// end of a stream. Not every backend accepts the option, so by default
+	// only the OpenAI API gets it.
+	StreamUsage *bool
+}
+
+func NewProvider(config ProviderConfig) (Provider, error) {
+	switch config.Provider {
+	case "", "openai":
+		// Only the real OpenAI API insists on a key; a custom base URL may
+		// point at a local OpenAI-compatible server that has none.
+		if config.APIKey == "" && config.BaseURL == "" {
+			return nil, fmt.Errorf("an API key is required for the openai provider")
+		}
+		return NewOpenAIService(config), nil
+	case "anthropic":
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("an API key is required for the anthropic provider")
+		}
+		return NewAnthropicService(config), nil
+	case "ollama":
+		return NewOllamaService(config), nil
+	case "fake":
+		return NewFakeProvider(config.Model), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", config.Provider)
+	}
+}
+
+// sendChunk delivers a chunk to the consumer, giving up if ctx is cancelled
+// so a consumer that went away can't leave the stream blocked forever. A
+// cancelled ctx wins even if the channel has room.
+func sendChunk(ctx context.Context, responseChan chan<- models.StreamChunk, chunk models.StreamChunk) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	select {
+	case responseChan <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// sleepContext waits for d, returning early with ctx.Err() on cancellation
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,403 @@
+package services
+
+import (
+	"bff/models"
+	"bff/sse"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collectStream runs a streaming call to completion and returns the reply
+// text, the last chunk seen and the first error reported.
+func collectStream(provider Provider, request models.ChatRequest) (string, models.StreamChunk, error) {
+	responseChan := make(chan models.StreamChunk, 100)
+	errorChan := make(chan error, 1)
+	go provider.StreamCompletion(context.Background(), request, responseChan, errorChan)
+
+	var content strings.Builder
+	var last models.StreamChunk
+	for chunk := range responseChan {
+		content.WriteString(chunk.Content)
+		last = chunk
+	}
+	return content.String(), last, <-errorChan
+}
+
+func TestNewProvider(t *testing.T) {
+	t.Run("should build the configured provider", func(t *testing.T) {
+		provider, err := NewProvider(ProviderConfig{Provider: "openai", APIKey: "key"})
+		require.NoError(t, err)
+		assert.Equal(t, "openai", provider.Name())
+
+		provider, err = NewProvider(ProviderConfig{Provider: "fake"})
+		require.NoError(t, err)
+		assert.Equal(t, "fake", provider.Name())
+	})
+
+	t.Run("should reject unknown providers and missing keys", func(t *testing.T) {
+		_, err := NewProvider(ProviderConfig{Provider: "nope"})
+		assert.Error(t, err)
+
+		_, err = NewProvider(ProviderConfig{Provider: "openai"})
+		assert.Error(t, err)
+	})
+}
+
+func TestOpenAIService(t *testing.T) {
+	var received models.OpenAIRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&received)) {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+
+		if received.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"model\":\"m\",\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+			fmt.Fprint(w, "data: {\"model\":\"m\",\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\n")
+			fmt.Fprint(w, "data: {\"model\":\"m\",\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		fmt.Fprint(w, `{"model":"m","choices":[{"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	service := NewOpenAIService(ProviderConfig{APIKey: "key", BaseURL: server.URL, Model: "default-model"})
+	request := models.ChatRequest{Messages: []models.Message{{Role: "user", Content: "Hi"}}}
+
+	t.Run("should stream chunks with finish reason and model", func(t *testing.T) {
+		content, last, err := collectStream(service, request)
+
+		require.NoError(t, err)
+		assert.Equal(t, "Hello", content)
+		assert.Equal(t, "stop", last.FinishReason)
+		assert.Equal(t, "m", last.Model)
+		assert.Equal(t, "default-model", received.Model)
+		assert.Nil(t, received.StreamOptions)
+	})
+
+	t.Run("should ask for usage only when configured to", func(t *testing.T) {
+		streamUsage := true
+		withUsage := NewOpenAIService(ProviderConfig{APIKey: "key", BaseURL: server.URL, StreamUsage: &streamUsage})
+
+		_, _, err := collectStream(withUsage, request)
+
+		require.NoError(t, err)
+		require.NotNil(t, received.StreamOptions)
+		assert.True(t, received.StreamOptions.IncludeUsage)
+		assert.True(t, NewOpenAIService(ProviderConfig{APIKey: "key"}).streamUsage)
+	})
+
+	t.Run("should return the whole reply when not streaming", func(t *testing.T) {
+		temperature, maxTokens := 0.2, 50
+		response, err := service.Complete(context.Background(), models.ChatRequest{
+			Model:    "other-model",
+			Messages: request.Messages,
+			Params:   models.GenerationParams{Temperature: &temperature, MaxTokens: &maxTokens, Stop: []string{"END"}},
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, "Hello", response.Content)
+		assert.Equal(t, "stop", response.FinishReason)
+		assert.Equal(t, "other-model", received.Model)
+		assert.Equal(t, 0.2, *received.Temperature)
+		assert.Equal(t, 50, *received.MaxTokens)
+		assert.Equal(t, []string{"END"}, received.Stop)
+	})
+}
+
+func TestFakeProvider(t *testing.T) {
+	provider := NewFakeProvider("")
+	request := models.ChatRequest{Messages: []models.Message{{Role: "user", Content: "ping pong"}}}
+
+	content, last, err := collectStream(provider, request)
+	require.NoError(t, err)
+	assert.Equal(t, "You said: ping pong", content)
+	assert.Equal(t, "stop", last.FinishReason)
+
+	response, err := provider.Complete(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, content, response.Content)
+}
+
+func TestAnthropicService(t *testing.T) {
+	var received models.AnthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&received)) {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, "/messages", r.URL.Path)
+		assert.Equal(t, "key", r.Header.Get("x-api-key"))
+		assert.Equal(t, anthropicAPIVersion, r.Header.Get("anthropic-version"))
+
+		if received.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"model\":\"claude-test\",\"usage\":{\"input_tokens\":12}}}\n\n")
+			fmt.Fprint(w, "event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n")
+			fmt.Fprint(w, "event: ping\ndata: {\"type\":\"ping\"}\n\n")
+			fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi \"}}\n\n")
+			fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"there\"}}\n\n")
+			fmt.Fprint(w, "event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n")
+			fmt.Fprint(w, "event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":2}}\n\n")
+			fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+			return
+		}
+		fmt.Fprint(w, `{"model":"claude-test","stop_reason":"max_tokens","content":[{"type":"text","text":"Hi there"}]}`)
+	}))
+	defer server.Close()
+
+	service := NewAnthropicService(ProviderConfig{APIKey: "key", BaseURL: server.URL})
+	request := models.ChatRequest{Messages: []models.Message{
+		{Role: "system", Content: "Be nice"},
+		{Role: "user", Content: "Hello"},
+	}}
+
+	t.Run("should map the event stream onto chunks", func(t *testing.T) {
+		content, last, err := collectStream(service, request)
+
+		require.NoError(t, err)
+		assert.Equal(t, "Hi there", content)
+		assert.Equal(t, "stop", last.FinishReason)
+		assert.Equal(t, "claude-test", last.Model)
+		assert.Equal(t, models.NewUsage(12, 2), last.Usage)
+		assert.Equal(t, "Be nice", received.System)
+		assert.Equal(t, []models.Message{{Role: "user", Content: "Hello"}}, received.Messages)
+		assert.Equal(t, defaultAnthropicModel, received.Model)
+	})
+
+	t.Run("should return the whole reply when not streaming", func(t *testing.T) {
+		response, err := service.Complete(context.Background(), request)
+
+		require.NoError(t, err)
+		assert.Equal(t, "Hi there", response.Content)
+		assert.Equal(t, "length", response.FinishReason)
+	})
+
+	t.Run("should report mid-stream errors", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n")
+		}))
+		defer failing.Close()
+
+		_, _, err := collectStream(NewAnthropicService(ProviderConfig{APIKey: "key", BaseURL: failing.URL}), request)
+
+		assert.ErrorContains(t, err, "overloaded_error")
+	})
+}
+
+func TestOllamaService(t *testing.T) {
+	var received models.OllamaRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&received)) {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, "/api/chat", r.URL.Path)
+		assert.Empty(t, r.Header.Get("Authorization"))
+
+		if received.Stream {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			fmt.Fprintln(w, `{"model":"llama3.2","message":{"role":"assistant","content":"Local "},"done":false}`)
+			fmt.Fprintln(w, `{"model":"llama3.2","message":{"role":"assistant","content":"model"},"done":false}`)
+			fmt.Fprintln(w, `{"model":"llama3.2","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop"}`)
+			return
+		}
+		fmt.Fprint(w, `{"model":"llama3.2","message":{"role":"assistant","content":"Local model"},"done":true}`)
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(ProviderConfig{Provider: "ollama", BaseURL: server.URL})
+	require.NoError(t, err)
+	request := models.ChatRequest{Messages: []models.Message{{Role: "user", Content: "Hello"}}}
+
+	t.Run("should stream NDJSON lines as chunks", func(t *testing.T) {
+		content, last, err := collectStream(provider, request)
+
+		require.NoError(t, err)
+		assert.Equal(t, "Local model", content)
+		assert.Equal(t, "stop", last.FinishReason)
+		assert.Equal(t, defaultOllamaModel, received.Model)
+	})
+
+	t.Run("should return the whole reply when not streaming", func(t *testing.T) {
+		response, err := provider.Complete(context.Background(), request)
+
+		require.NoError(t, err)
+		assert.Equal(t, "Local model", response.Content)
+		assert.Equal(t, "stop", response.FinishReason)
+	})
+}
+
+func TestOpenAICompatibleWithoutKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"model":"local","choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(ProviderConfig{Provider: "openai", BaseURL: server.URL + "/v1/"})
+	require.NoError(t, err)
+
+	response, err := provider.Complete(context.Background(), models.ChatRequest{Messages: []models.Message{{Role: "user", Content: "Hi"}}})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", response.Content)
+}
+
+func TestStreamCancellation(t *testing.T) {
+	t.Run("should stop a stream whose consumer went away", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for {
+				if _, err := fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"x\"}}]}\n\n"); err != nil {
+					return
+				}
+				w.(http.Flusher).Flush()
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(time.Millisecond):
+				}
+			}
+		}))
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		responseChan := make(chan models.StreamChunk) // never read
+		errorChan := make(chan error, 1)
+		done := make(chan struct{})
+		go func() {
+			NewOpenAIService(ProviderConfig{APIKey: "key", BaseURL: server.URL}).StreamCompletion(ctx, models.ChatRequest{}, responseChan, errorChan)
+			close(done)
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("stream goroutine did not stop after cancellation")
+		}
+		assert.ErrorIs(t, <-errorChan, context.Canceled)
+	})
+
+	t.Run("should not retry a cancelled call", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		provider, delays := newTestRetryProvider(&FakeProvider{Err: &UpstreamError{Retryable: true, Message: "down"}}, 3)
+
+		_, err := provider.Complete(ctx, models.ChatRequest{})
+
+		assert.Error(t, err)
+		assert.Empty(t, *delays)
+	})
+
+	t.Run("should not send or sleep once the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// The channel has room, so only the cancellation keeps the chunk out
+		responseChan := make(chan models.StreamChunk, 1)
+		for range 100 {
+			assert.False(t, sendChunk(ctx, responseChan, models.StreamChunk{Content: "x"}))
+		}
+		assert.Empty(t, responseChan)
+
+		for range 100 {
+			assert.ErrorIs(t, sleepContext(ctx, 0), context.Canceled)
+		}
+		start := time.Now()
+		assert.ErrorIs(t, sleepContext(ctx, time.Hour), context.Canceled)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestOpenAIStreamErrors(t *testing.T) {
+	request := models.ChatRequest{Messages: []models.Message{{Role: "user", Content: "Hi"}}}
+
+	stream := func(body string) (string, error) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		}))
+		defer server.Close()
+
+		content, _, err := collectStream(NewOpenAIService(ProviderConfig{APIKey: "key", BaseURL: server.URL}), request)
+		return content, err
+	}
+
+	t.Run("should report error objects sent mid-stream", func(t *testing.T) {
+		_, err := stream("data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\ndata: {\"error\":{\"type\":\"server_error\",\"message\":\"boom\"}}\n\n")
+
+		var upstreamErr *UpstreamError
+		require.ErrorAs(t, err, &upstreamErr)
+		assert.True(t, upstreamErr.Retryable)
+		assert.Contains(t, upstreamErr.Message, "boom")
+	})
+
+	t.Run("should report payloads that are not JSON", func(t *testing.T) {
+		_, err := stream("data: {\"choices\":\n\n")
+
+		var decodeErr *sse.DecodeError
+		assert.ErrorAs(t, err, &decodeErr)
+	})
+
+	t.Run("should read multi-line data with CRLF line endings", func(t *testing.T) {
+		content, err := stream("data: {\"choices\":\r\ndata: [{\"delta\":{\"content\":\"Hi\"}}]}\r\n\r\ndata: [DONE]\r\n\r\n")
+
+		require.NoError(t, err)
+		assert.Equal(t, "Hi", content)
+	})
+}
+
+func TestOllamaStreamErrors(t *testing.T) {
+	request := models.ChatRequest{Messages: []models.Message{{Role: "user", Content: "Hi"}}}
+
+	stream := func(body string) (string, models.StreamChunk, error) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		}))
+		defer server.Close()
+
+		return collectStream(NewOllamaService(ProviderConfig{BaseURL: server.URL}), request)
+	}
+
+	t.Run("should report a stream cut off before done as retryable", func(t *testing.T) {
+		content, last, err := stream(`{"model":"llama3.2","message":{"content":"Hel"},"done":false}` + "\n")
+
+		assert.Equal(t, "Hel", content)
+		assert.Empty(t, last.FinishReason)
+		var upstreamErr *UpstreamError
+		require.ErrorAs(t, err, &upstreamErr)
+		assert.True(t, upstreamErr.Retryable)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("should report error lines sent mid-stream", func(t *testing.T) {
+		_, _, err := stream(`{"model":"llama3.2","message":{"content":"Hel"},"done":false}` + "\n" + `{"error":"model runner has unexpectedly stopped"}` + "\n")
+
+		var upstreamErr *UpstreamError
+		require.ErrorAs(t, err, &upstreamErr)
+		assert.True(t, upstreamErr.Retryable)
+		assert.Contains(t, upstreamErr.Message, "model runner has unexpectedly stopped")
+	})
+
+	t.Run("should not retry a missing model", func(t *testing.T) {
+		_, _, err := stream(`{"error":"model \"llama9\" not found, try pulling it first"}` + "\n")
+
+		var upstreamErr *UpstreamError
+		require.ErrorAs(t, err, &upstreamErr)
+		assert.False(t, upstreamErr.Retryable)
+	})
+}
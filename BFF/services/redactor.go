@@ -0,0 +1,75 @@
+package services
+
+import (
+	"bff/models"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Styles of redaction
+const (
+	// RedactPlaceholder replaces each matched span with "[REDACTED]"
+	RedactPlaceholder = "placeholder"
+	// RedactAsterisks masks every character of a matched span with "*",
+	// keeping its length and spaces
+	RedactAsterisks = "asterisks"
+)
+
+const redactedPlaceholder = "[REDACTED]"
+
+// Redactor rewrites texts with the keywords found in them masked. A nil
+// Redactor uses the placeholder style.
+type Redactor struct {
+	style string
+}
+
+func NewRedactor(style string) (*Redactor, error) {
+	switch style {
+	case RedactPlaceholder, RedactAsterisks:
+		return &Redactor{style: style}, nil
+	default:
+		return nil, fmt.Errorf("unknown redaction style %q, expected %s or %s", style, RedactPlaceholder, RedactAsterisks)
+	}
+}
+
+// Redact returns the text with the spans of the matches masked. Spans that
+// overlap, like those of "credit card" and "card", are masked as one.
+func (r *Redactor) Redact(text string, matches []models.KeywordMatch) string {
+	spans := make([][2]int, 0, len(matches))
+	for _, match := range matches {
+		spans = append(spans, [2]int{match.Start, match.End})
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i][0] < spans[j][0]
+	})
+
+	var redacted strings.Builder
+	pos := 0
+	for i := 0; i < len(spans); {
+		start, end := spans[i][0], spans[i][1]
+		for i++; i < len(spans) && spans[i][0] < end; i++ {
+			end = max(end, spans[i][1])
+		}
+
+		redacted.WriteString(text[pos:start])
+		redacted.WriteString(r.mask(text[start:end]))
+		pos = end
+	}
+	redacted.WriteString(text[pos:])
+	return redacted.String()
+}
+
+func (r *Redactor) mask(span string) string {
+	if r == nil || r.style == RedactPlaceholder {
+		return redactedPlaceholder
+	}
+
+	return strings.Map(func(c rune) rune {
+		if unicode.IsSpace(c) {
+			return c
+		}
+		return '*'
+	}, span)
+}
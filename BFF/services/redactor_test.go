@@ -0,0 +1,43 @@
+package services
+
+import (
+	"bff/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor(t *testing.T) {
+	text := "My credit card is 1234, card!"
+	matches := []models.KeywordMatch{
+		{Start: 3, End: 14},  // "credit card"
+		{Start: 10, End: 14}, // "card"
+		{Start: 24, End: 28}, // "card"
+	}
+
+	t.Run("should replace each span with a placeholder", func(t *testing.T) {
+		redactor, err := NewRedactor(RedactPlaceholder)
+		require.NoError(t, err)
+		assert.Equal(t, "My [REDACTED] is 1234, [REDACTED]!", redactor.Redact(text, matches))
+
+		var none *Redactor
+		assert.Equal(t, "My [REDACTED] is 1234, [REDACTED]!", none.Redact(text, matches))
+	})
+
+	t.Run("should mask each character with asterisks", func(t *testing.T) {
+		redactor, err := NewRedactor(RedactAsterisks)
+		require.NoError(t, err)
+		assert.Equal(t, "My ****** **** is 1234, ****!", redactor.Redact(text, matches))
+		assert.Equal(t, "a ** b", redactor.Redact("a ѕé b", []models.KeywordMatch{{Start: 2, End: 6}}))
+	})
+
+	t.Run("should leave text without matches alone", func(t *testing.T) {
+		assert.Equal(t, text, (&Redactor{}).Redact(text, nil))
+	})
+
+	t.Run("should reject unknown styles", func(t *testing.T) {
+		_, err := NewRedactor("blur")
+		assert.Error(t, err)
+	})
+}
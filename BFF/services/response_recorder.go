@@ -0,0 +1,59 @@
+package services
+
+import (
+	"bff/models"
+	"strings"
+	"time"
+)
+
+// ResponseRecorder accumulates streamed chunks into an AssistantResponse
+// and keeps track of when the first token arrived and when the stream ended.
+type ResponseRecorder struct {
+	response     models.AssistantResponse
+	content      strings.Builder
+	firstTokenAt time.Time
+}
+
+func NewResponseRecorder(messageId string) *ResponseRecorder {
+	return &ResponseRecorder{
+		response: models.AssistantResponse{
+			MessageId: messageId,
+			StartedAt: time.Now(),
+		},
+	}
+}
+
+func (r *ResponseRecorder) Add(chunk models.StreamChunk) {
+	if chunk.Content != "" && r.firstTokenAt.IsZero() {
+		r.firstTokenAt = time.Now()
+	}
+	r.content.WriteString(chunk.Content)
+
+	if chunk.Model != "" {
+		r.response.Model = chunk.Model
+	}
+	if chunk.Provider != "" {
+		r.response.Provider = chunk.Provider
+	}
+	if chunk.FinishReason != "" {
+		r.response.FinishReason = chunk.FinishReason
+	}
+	if chunk.Usage != nil {
+		r.response.Usage = chunk.Usage
+	}
+}
+
+// Finish closes the recording. finishReason is only used when the upstream
+// never reported one itself, e.g. because the stream failed.
+func (r *ResponseRecorder) Finish(finishReason string) models.AssistantResponse {
+	r.response.CompletedAt = time.Now()
+	r.response.Content = r.content.String()
+	r.response.DurationMs = r.response.CompletedAt.Sub(r.response.StartedAt).Milliseconds()
+	if !r.firstTokenAt.IsZero() {
+		r.response.LatencyMs = r.firstTokenAt.Sub(r.response.StartedAt).Milliseconds()
+	}
+	if r.response.FinishReason == "" {
+		r.response.FinishReason = finishReason
+	}
+	return r.response
+}
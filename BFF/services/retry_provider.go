@@ -0,0 +1,133 @@
+package services
+
+import (
+	"bff/models"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryConfig controls how RetryProvider retries failed upstream calls
+type RetryConfig struct {
+	// MaxAttempts counts the first attempt, so 1 disables retries
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// RetryProvider wraps a Provider and retries rate-limited, failing or
+// unreachable upstream calls with jittered exponential backoff. Streams are
+// only retried until the first chunk arrives, so clients never see a reply
+// twice.
+type RetryProvider struct {
+	provider Provider
+	config   RetryConfig
+	sleep    func(context.Context, time.Duration) error
+}
+
+func NewRetryProvider(provider Provider, config RetryConfig) *RetryProvider {
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+	return &RetryProvider{
+		provider: provider,
+		config:   config,
+		sleep:    sleepContext,
+	}
+}
+
+func (p *RetryProvider) Name() string {
+	return p.provider.Name()
+}
+
+func (p *RetryProvider) StreamCompletion(ctx context.Context, request models.ChatRequest, responseChan chan<- models.StreamChunk, errorChan chan<- error) {
+	defer close(responseChan)
+	defer close(errorChan)
+
+	for attempt := 1; ; attempt++ {
+		attemptChan := make(chan models.StreamChunk, cap(responseChan))
+		attemptErrorChan := make(chan error, 1)
+		go p.provider.StreamCompletion(ctx, request, attemptChan, attemptErrorChan)
+
+		started := false
+		for chunk := range attemptChan {
+			started = true
+			if !sendChunk(ctx, responseChan, chunk) {
+				errorChan <- ctx.Err()
+				return
+			}
+		}
+
+		err := <-attemptErrorChan
+		if err == nil {
+			return
+		}
+
+		delay, retry := p.nextDelay(ctx, attempt, err)
+		if started || !retry {
+			errorChan <- err
+			return
+		}
+
+		retryChunk := models.StreamChunk{
+			Retry: &models.RetryInfo{
+				Attempt:     attempt + 1,
+				MaxAttempts: p.config.MaxAttempts,
+				DelayMs:     delay.Milliseconds(),
+				Reason:      err.Error(),
+			},
+		}
+		if !sendChunk(ctx, responseChan, retryChunk) {
+			errorChan <- ctx.Err()
+			return
+		}
+		if err := p.sleep(ctx, delay); err != nil {
+			errorChan <- err
+			return
+		}
+	}
+}
+
+func (p *RetryProvider) Complete(ctx context.Context, request models.ChatRequest) (*models.ChatResponse, error) {
+	for attempt := 1; ; attempt++ {
+		response, err := p.provider.Complete(ctx, request)
+		if err == nil {
+			return response, nil
+		}
+
+		delay, retry := p.nextDelay(ctx, attempt, err)
+		if !retry {
+			return nil, err
+		}
+		if err := p.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *RetryProvider) ValidateAPIKey() error {
+	return p.provider.ValidateAPIKey()
+}
+
+// nextDelay decides whether a failed attempt is retried and how long to wait
+// first. A server-requested wait longer than MaxDelay isn't worth holding
+// the client for, so the error is returned instead. Nothing is retried once
+// the caller has cancelled.
+func (p *RetryProvider) nextDelay(ctx context.Context, attempt int, err error) (time.Duration, bool) {
+	var upstreamErr *UpstreamError
+	if ctx.Err() != nil || !errors.As(err, &upstreamErr) || !upstreamErr.Retryable || attempt >= p.config.MaxAttempts {
+		return 0, false
+	}
+
+	if upstreamErr.RetryAfter > 0 {
+		return upstreamErr.RetryAfter, upstreamErr.RetryAfter <= p.config.MaxDelay
+	}
+
+	// Equal jitter: half the exponential delay, plus up to the other half at random
+	backoff := min(p.config.BaseDelay<<min(attempt-1, 20), p.config.MaxDelay)
+	if backoff <= 0 {
+		return 0, true
+	}
+	return backoff/2 + rand.N(backoff/2+1), true
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"bff/models"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRetryProvider(provider Provider, maxAttempts int) (*RetryProvider, *[]time.Duration) {
+	var delays []time.Duration
+	retryProvider := NewRetryProvider(provider, RetryConfig{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    time.Second,
+	})
+	retryProvider.sleep = func(ctx context.Context, delay time.Duration) error {
+		delays = append(delays, delay)
+		return nil
+	}
+	return retryProvider, &delays
+}
+
+func TestRetryProvider(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "0.25")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			fmt.Fprint(w, "data: {\"model\":\"m\",\"choices\":[{\"delta\":{\"content\":\"ok\"},\"finish_reason\":\"stop\"}]}\n\n")
+		}
+	}))
+	defer server.Close()
+
+	request := models.ChatRequest{Messages: []models.Message{{Role: "user", Content: "Hi"}}}
+
+	t.Run("should retry 429 and 5xx responses and announce each retry", func(t *testing.T) {
+		calls.Store(0)
+		provider, delays := newTestRetryProvider(NewOpenAIService(ProviderConfig{APIKey: "key", BaseURL: server.URL}), 3)
+
+		responseChan := make(chan models.StreamChunk, 10)
+		errorChan := make(chan error, 1)
+		go provider.StreamCompletion(context.Background(), request, responseChan, errorChan)
+
+		var retries []*models.RetryInfo
+		var content string
+		for chunk := range responseChan {
+			if chunk.Retry != nil {
+				retries = append(retries, chunk.Retry)
+			}
+			content += chunk.Content
+		}
+
+		require.NoError(t, <-errorChan)
+		assert.Equal(t, "ok", content)
+		require.Len(t, retries, 2)
+		assert.Equal(t, 2, retries[0].Attempt)
+		assert.Equal(t, int64(250), retries[0].DelayMs)
+		assert.Equal(t, 3, retries[1].Attempt)
+		assert.Equal(t, 250*time.Millisecond, (*delays)[0])
+		assert.GreaterOrEqual(t, (*delays)[1], 100*time.Millisecond)
+		assert.LessOrEqual(t, (*delays)[1], 200*time.Millisecond)
+	})
+
+	t.Run("should give up after max attempts", func(t *testing.T) {
+		calls.Store(0)
+		provider, _ := newTestRetryProvider(NewOpenAIService(ProviderConfig{APIKey: "key", BaseURL: server.URL}), 2)
+
+		_, err := provider.Complete(context.Background(), request)
+
+		var upstreamErr *UpstreamError
+		require.ErrorAs(t, err, &upstreamErr)
+		assert.Equal(t, http.StatusBadGateway, upstreamErr.StatusCode)
+	})
+
+	t.Run("should not retry client errors", func(t *testing.T) {
+		fake := &FakeProvider{Err: &UpstreamError{StatusCode: http.StatusBadRequest, Message: "bad request"}}
+		provider, delays := newTestRetryProvider(fake, 3)
+
+		_, _, err := collectStream(provider, request)
+
+		assert.EqualError(t, err, "bad request")
+		assert.Empty(t, *delays)
+	})
+
+	t.Run("should not retry plain errors", func(t *testing.T) {
+		provider, delays := newTestRetryProvider(&FakeProvider{Err: errors.New("boom")}, 3)
+
+		_, err := provider.Complete(context.Background(), request)
+
+		assert.EqualError(t, err, "boom")
+		assert.Empty(t, *delays)
+	})
+}
+
+func TestRetryAfterFromHeaders(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	header := http.Header{}
+	header.Set("Retry-After", "3")
+	assert.Equal(t, 3*time.Second, retryAfterFromHeaders(header, now))
+
+	header = http.Header{}
+	header.Set("Retry-After", now.Add(5*time.Second).Format(http.TimeFormat))
+	assert.Equal(t, 5*time.Second, retryAfterFromHeaders(header, now))
+
+	header = http.Header{}
+	header.Set("retry-after-ms", "150")
+	assert.Equal(t, 150*time.Millisecond, retryAfterFromHeaders(header, now))
+
+	header = http.Header{}
+	header.Set("x-ratelimit-remaining-requests", "0")
+	header.Set("x-ratelimit-reset-requests", "1.5s")
+	header.Set("x-ratelimit-remaining-tokens", "10")
+	header.Set("x-ratelimit-reset-tokens", "6m0s")
+	assert.Equal(t, 1500*time.Millisecond, retryAfterFromHeaders(header, now))
+
+	assert.Zero(t, retryAfterFromHeaders(http.Header{}, now))
+}
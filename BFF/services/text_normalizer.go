@@ -0,0 +1,392 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Steps of the normalization pipeline
+const (
+	// NormalizeNFKC folds compatibility characters such as fullwidth and
+	// mathematical letters or ligatures into their plain form
+	NormalizeNFKC = "nfkc"
+	// NormalizeZeroWidth drops invisible format characters such as zero
+	// width spaces and joiners
+	NormalizeZeroWidth = "zero_width"
+	// NormalizeDiacritics strips accents, e.g. "é" becomes "e"
+	NormalizeDiacritics = "diacritics"
+	// NormalizeConfusables maps look-alike letters of other scripts, such
+	// as Cyrillic "ѕ", to the Latin letter they imitate
+	NormalizeConfusables = "confusables"
+	// NormalizeLeetspeak reads digits and symbols within words as the
+	// letters they stand for, e.g. "sp@m" becomes "spam"
+	NormalizeLeetspeak = "leetspeak"
+	// NormalizeSpacedLetters joins words spelled out letter by letter,
+	// such as "s p a m" or "s.p.a.m"
+	NormalizeSpacedLetters = "spaced_letters"
+)
+
+// NormalizationSteps lists every step in the order in which they run
+var NormalizationSteps = []string{
+	NormalizeNFKC,
+	NormalizeZeroWidth,
+	NormalizeDiacritics,
+	NormalizeConfusables,
+	NormalizeLeetspeak,
+	NormalizeSpacedLetters,
+}
+
+// wordPunctuation is trimmed from both ends of every word
+const wordPunctuation = ".,!?;:\"'"
+
+// letterSeparators may separate the letters of a word spelled out as one
+// word, e.g. "s.p.a.m" or "s-p-a-m"
+const letterSeparators = ".-_*·•/"
+
+// minSpacedLetters is how many letters in a row make a spelled out word,
+// so that ordinary single letter words like "a" are left alone
+const minSpacedLetters = 3
+
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'һ': 'h', 'н': 'h', 'і': 'i', 'ј': 'j', 'к': 'k',
+	'ӏ': 'l', 'м': 'm', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'т': 't', 'с': 'c',
+	'у': 'y', 'ү': 'y', 'ԁ': 'd', 'ԝ': 'w', 'х': 'x',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x',
+	// Latin look-alikes
+	'ı': 'i', 'ɑ': 'a', 'ɡ': 'g', 'ɩ': 'i', 'ʏ': 'y',
+}
+
+// undecomposable are letters with a stroke or ligatures, which don't lose
+// their accent through decomposition
+var undecomposable = map[rune]string{
+	'ø': "o", 'ł': "l", 'đ': "d", 'ħ': "h", 'ŧ': "t", 'ß': "ss", 'æ': "ae", 'œ': "oe",
+}
+
+var leetspeak = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '3': 'e', '6': 'g', '1': 'i', '!': 'i', '|': 'l',
+	'0': 'o', '5': 's', '$': 's', '7': 't', '+': 't',
+}
+
+// stepSet holds steps of the pipeline as bits, in the order of
+// NormalizationSteps
+type stepSet uint8
+
+func stepBit(step string) stepSet {
+	for i, candidate := range NormalizationSteps {
+		if candidate == step {
+			return 1 << i
+		}
+	}
+	return 0
+}
+
+// names returns the steps of the set in the order in which they run
+func (s stepSet) names() []string {
+	var names []string
+	for i, step := range NormalizationSteps {
+		if s&(1<<i) != 0 {
+			names = append(names, step)
+		}
+	}
+	return names
+}
+
+// normalizedRune is a rune of the normalized text along with the bytes of
+// the original text it stands for, and the steps that changed it
+type normalizedRune struct {
+	r     rune
+	start int
+	end   int
+	steps stepSet
+}
+
+// normalizedToken is a word of the normalized text. Start and End are the
+// byte offsets of the original text it came from, and Steps lists the
+// steps that changed it.
+type normalizedToken struct {
+	Text  string
+	Start int
+	End   int
+	Steps []string
+}
+
+// TextNormalizer undoes common ways of disguising words before keywords
+// are looked up, keeping track of where each word came from in the
+// original text. Lowercasing and trimming punctuation always apply; the
+// other steps can be picked. A nil TextNormalizer runs no optional steps.
+type TextNormalizer struct {
+	steps map[string]bool
+}
+
+// NewTextNormalizer enables the given steps, which run in the order of
+// NormalizationSteps whatever the order they are given in
+func NewTextNormalizer(steps []string) (*TextNormalizer, error) {
+	n := &TextNormalizer{steps: make(map[string]bool)}
+	for _, step := range steps {
+		known := false
+		for _, candidate := range NormalizationSteps {
+			known = known || candidate == step
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown normalization step %q, expected one of %s", step, strings.Join(NormalizationSteps, ", "))
+		}
+		n.steps[step] = true
+	}
+	return n, nil
+}
+
+// Steps returns the enabled steps in the order in which they run
+func (n *TextNormalizer) Steps() []string {
+	var steps []string
+	for _, step := range NormalizationSteps {
+		if n.enabled(step) {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+func (n *TextNormalizer) enabled(step string) bool {
+	return n != nil && n.steps[step]
+}
+
+// Tokens normalizes the text and splits it into words
+func (n *TextNormalizer) Tokens(text string) []normalizedToken {
+	runes := n.normalizeRunes(text)
+
+	var words [][]normalizedRune
+	for _, word := range splitWords(runes) {
+		word = trimPunctuation(word)
+		if len(word) == 0 {
+			continue
+		}
+		if n.enabled(NormalizeLeetspeak) && containsLetter(word) {
+			word = mapLeetspeak(word)
+		}
+		if n.enabled(NormalizeSpacedLetters) {
+			word = joinSeparatedLetters(word)
+		}
+		words = append(words, word)
+	}
+	if n.enabled(NormalizeSpacedLetters) {
+		words = n.joinSpacedLetters(words)
+	}
+
+	tokens := make([]normalizedToken, 0, len(words))
+	for _, word := range words {
+		var text strings.Builder
+		var steps stepSet
+		for _, nr := range word {
+			text.WriteRune(nr.r)
+			steps |= nr.steps
+		}
+		tokens = append(tokens, normalizedToken{
+			Text:  text.String(),
+			Start: word[0].start,
+			End:   word[len(word)-1].end,
+			Steps: steps.names(),
+		})
+	}
+	return tokens
+}
+
+// normalizeRunes runs the steps that work on single characters
+func (n *TextNormalizer) normalizeRunes(text string) []normalizedRune {
+	var runes []normalizedRune
+
+	if n.enabled(NormalizeNFKC) {
+		// The iterator hands out the normalized form of one segment of the
+		// input at a time, e.g. a letter and its combining accents
+		var it norm.Iter
+		it.InitString(norm.NFKC, text)
+		for !it.Done() {
+			start := it.Pos()
+			segment := string(it.Next())
+
+			var steps stepSet
+			if segment != text[start:it.Pos()] {
+				steps = stepBit(NormalizeNFKC)
+			}
+			for _, r := range segment {
+				runes = append(runes, normalizedRune{r: r, start: start, end: it.Pos(), steps: steps})
+			}
+		}
+	} else {
+		for i := 0; i < len(text); {
+			r, size := utf8.DecodeRuneInString(text[i:])
+			runes = append(runes, normalizedRune{r: r, start: i, end: i + size})
+			i += size
+		}
+	}
+
+	out := runes[:0:0]
+	// droppedZeroWidth marks the next rune as changed by a zero width
+	// character removed before it
+	droppedZeroWidth := false
+	for _, nr := range runes {
+		if n.enabled(NormalizeZeroWidth) && unicode.Is(unicode.Cf, nr.r) {
+			droppedZeroWidth = true
+			continue
+		}
+		if droppedZeroWidth {
+			nr.steps |= stepBit(NormalizeZeroWidth)
+			droppedZeroWidth = false
+		}
+		nr.r = unicode.ToLower(nr.r)
+
+		replacement := []rune{nr.r}
+		if n.enabled(NormalizeDiacritics) {
+			replacement = stripDiacritics(nr.r)
+			if len(replacement) != 1 || replacement[0] != nr.r {
+				nr.steps |= stepBit(NormalizeDiacritics)
+			}
+		}
+		for _, r := range replacement {
+			steps := nr.steps
+			if folded, exists := confusables[r]; exists && n.enabled(NormalizeConfusables) {
+				r = folded
+				steps |= stepBit(NormalizeConfusables)
+			}
+			out = append(out, normalizedRune{r: r, start: nr.start, end: nr.end, steps: steps})
+		}
+	}
+	return out
+}
+
+// stripDiacritics returns the letter without its accents
+func stripDiacritics(r rune) []rune {
+	if r < utf8.RuneSelf {
+		return []rune{r}
+	}
+	if plain, exists := undecomposable[r]; exists {
+		return []rune(plain)
+	}
+
+	var stripped []rune
+	for _, d := range norm.NFD.String(string(r)) {
+		if !unicode.Is(unicode.Mn, d) {
+			stripped = append(stripped, d)
+		}
+	}
+	return stripped
+}
+
+func splitWords(runes []normalizedRune) [][]normalizedRune {
+	var words [][]normalizedRune
+	start := -1
+	for i, nr := range runes {
+		if unicode.IsSpace(nr.r) {
+			if start >= 0 {
+				words = append(words, runes[start:i])
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, runes[start:])
+	}
+	return words
+}
+
+func trimPunctuation(word []normalizedRune) []normalizedRune {
+	for len(word) > 0 && strings.ContainsRune(wordPunctuation, word[0].r) {
+		word = word[1:]
+	}
+	for len(word) > 0 && strings.ContainsRune(wordPunctuation, word[len(word)-1].r) {
+		word = word[:len(word)-1]
+	}
+	return word
+}
+
+func containsLetter(word []normalizedRune) bool {
+	for _, nr := range word {
+		if unicode.IsLetter(nr.r) {
+			return true
+		}
+	}
+	return false
+}
+
+// mapLeetspeak returns a copy of the word with leetspeak read as letters
+func mapLeetspeak(word []normalizedRune) []normalizedRune {
+	mapped := make([]normalizedRune, len(word))
+	for i, nr := range word {
+		if letter, exists := leetspeak[nr.r]; exists {
+			nr.r = letter
+			nr.steps |= stepBit(NormalizeLeetspeak)
+		}
+		mapped[i] = nr
+	}
+	return mapped
+}
+
+// joinSeparatedLetters turns a word like "s.p.a.m" into "spam"
+func joinSeparatedLetters(word []normalizedRune) []normalizedRune {
+	if len(word) < 2*minSpacedLetters-1 || len(word)%2 == 0 {
+		return word
+	}
+	for i, nr := range word {
+		if i%2 == 0 && !unicode.IsLetter(nr.r) {
+			return word
+		}
+		if i%2 == 1 && !strings.ContainsRune(letterSeparators, nr.r) {
+			return word
+		}
+	}
+
+	joined := make([]normalizedRune, 0, len(word)/2+1)
+	for i := 0; i < len(word); i += 2 {
+		letter := word[i]
+		letter.steps |= stepBit(NormalizeSpacedLetters)
+		joined = append(joined, letter)
+	}
+	return joined
+}
+
+// joinSpacedLetters merges runs of single letter words, like "s p a m",
+// into one word
+func (n *TextNormalizer) joinSpacedLetters(words [][]normalizedRune) [][]normalizedRune {
+	var joined [][]normalizedRune
+	for i := 0; i < len(words); {
+		end := i
+		for end < len(words) && n.isSpelledLetter(words[end]) {
+			end++
+		}
+		if end-i < minSpacedLetters {
+			joined = append(joined, words[i])
+			i++
+			continue
+		}
+
+		var word []normalizedRune
+		for _, letter := range words[i:end] {
+			letter[0].steps |= stepBit(NormalizeSpacedLetters)
+			word = append(word, letter[0])
+		}
+		if n.enabled(NormalizeLeetspeak) {
+			word = mapLeetspeak(word)
+		}
+		joined = append(joined, word)
+		i = end
+	}
+	return joined
+}
+
+// isSpelledLetter reports whether a word is a single letter, or a single
+// leetspeak character standing for one
+func (n *TextNormalizer) isSpelledLetter(word []normalizedRune) bool {
+	if len(word) != 1 {
+		return false
+	}
+	_, isLeet := leetspeak[word[0].r]
+	return unicode.IsLetter(word[0].r) || (isLeet && n.enabled(NormalizeLeetspeak))
+}
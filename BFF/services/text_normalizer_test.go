@@ -0,0 +1,97 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tokenTexts(tokens []normalizedToken) []string {
+	var texts []string
+	for _, token := range tokens {
+		texts = append(texts, token.Text)
+	}
+	return texts
+}
+
+func TestTextNormalizer(t *testing.T) {
+	normalizer, err := NewTextNormalizer(NormalizationSteps)
+	require.NoError(t, err)
+
+	t.Run("should undo each kind of disguise", func(t *testing.T) {
+		cases := map[string]string{
+			"sp@m":             "spam",
+			"5P4M!":            "spam",
+			"s p a m":          "spam",
+			"s.p.a.m":          "spam",
+			"ѕраm":             "spam",
+			"spa\u200bm":       "spam",
+			"s\u200dp\u200dam": "spam",
+			"ｓｐａｍ":             "spam",
+			"spâm":             "spam",
+			"spa\u0301m":       "spam",
+			"straße":           "strasse",
+			"ΑΡΕ":              "ape",
+			"\"Spam,\"":        "spam",
+			"\u00a0spam ":      "spam",
+		}
+		for text, expected := range cases {
+			assert.Equal(t, []string{expected}, tokenTexts(normalizer.Tokens(text)), text)
+		}
+	})
+
+	t.Run("should leave ordinary text alone", func(t *testing.T) {
+		tokens := normalizer.Tokens("I have 3 cats, a dog and 1200 fish.")
+		assert.Equal(t, []string{"i", "have", "3", "cats", "a", "dog", "and", "1200", "fish"}, tokenTexts(tokens))
+	})
+
+	t.Run("should point back to the original text", func(t *testing.T) {
+		text := "Buy ѕ p @ m, now"
+		tokens := normalizer.Tokens(text)
+		require.Len(t, tokens, 3)
+
+		assert.Equal(t, "ѕ p @ m", text[tokens[1].Start:tokens[1].End])
+		assert.Equal(t, "now", text[tokens[2].Start:tokens[2].End])
+
+		text = "ｓｐａｍ and spa\u0301m"
+		tokens = normalizer.Tokens(text)
+		require.Len(t, tokens, 3)
+		assert.Equal(t, "ｓｐａｍ", text[tokens[0].Start:tokens[0].End])
+		assert.Equal(t, "spa\u0301m", text[tokens[2].Start:tokens[2].End])
+	})
+
+	t.Run("should record which steps changed each word", func(t *testing.T) {
+		cases := map[string][]string{
+			"spam":       nil,
+			"ｓｐａｍ":       {NormalizeNFKC},
+			"sp\u200bam": {NormalizeZeroWidth},
+			"spâm":       {NormalizeDiacritics},
+			"ѕpam":       {NormalizeConfusables},
+			"sp@m":       {NormalizeLeetspeak},
+			"s p a m":    {NormalizeSpacedLetters},
+			"s.p.4.m":    {NormalizeLeetspeak, NormalizeSpacedLetters},
+		}
+		for text, steps := range cases {
+			tokens := normalizer.Tokens(text)
+			require.Len(t, tokens, 1, text)
+			assert.Equal(t, steps, tokens[0].Steps, text)
+		}
+	})
+
+	t.Run("should only run the enabled steps", func(t *testing.T) {
+		leetOnly, err := NewTextNormalizer([]string{NormalizeLeetspeak})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"spam", "s", "p", "a", "m", "ѕpam"}, tokenTexts(leetOnly.Tokens("SP@M s p a m ѕpam")))
+		assert.Equal(t, []string{NormalizeLeetspeak}, leetOnly.Steps())
+
+		var none *TextNormalizer
+		assert.Equal(t, []string{"sp@m", "spâm"}, tokenTexts(none.Tokens("Sp@m spâm!")))
+	})
+
+	t.Run("should reject unknown steps", func(t *testing.T) {
+		_, err := NewTextNormalizer([]string{"nfkc", "rot13"})
+		assert.Error(t, err)
+	})
+}
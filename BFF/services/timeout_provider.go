@@ -0,0 +1,221 @@
+package services
+
+import (
+	"bff/models"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Codes reported when one of the streaming deadlines fires
+const (
+	ConnectTimeout    = "connect_timeout"
+	FirstTokenTimeout = "first_token_timeout"
+	IdleTimeout       = "idle_timeout"
+	TotalTimeout      = "total_timeout"
+)
+
+// validateAPIKeyTimeout bounds the startup key check, which has no caller
+// context to inherit a deadline from
+const validateAPIKeyTimeout = 30 * time.Second
+
+// TimeoutError reports which deadline ended a generation
+type TimeoutError struct {
+	Code    string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Timeout == 0 {
+		return e.Code
+	}
+	return fmt.Sprintf("%s after %s", e.Code, e.Timeout)
+}
+
+// TimeoutConfig holds the streaming deadlines. A zero value disables the
+// corresponding deadline.
+type TimeoutConfig struct {
+	// Connect bounds dialing and the TLS handshake with the provider
+	Connect time.Duration
+	// FirstToken bounds the wait for the first chunk of the reply
+	FirstToken time.Duration
+	// Idle bounds the silence between two chunks
+	Idle time.Duration
+	// Total bounds the whole generation
+	Total time.Duration
+}
+
+// ForTarget keeps the deadlines that judge a single provider. They belong
+// on each step of a failover chain, so that a stalled provider fails over
+// and trips its breaker instead of ending the whole generation.
+func (c TimeoutConfig) ForTarget() TimeoutConfig {
+	return TimeoutConfig{FirstToken: c.FirstToken, Idle: c.Idle}
+}
+
+// ForChain keeps the total deadline, which bounds a failover chain as a
+// whole
+func (c TimeoutConfig) ForChain() TimeoutConfig {
+	return TimeoutConfig{Total: c.Total}
+}
+
+// newHTTPClient builds the client providers use. It deliberately has no
+// overall timeout, which would cut long streams off midway; streams are
+// bounded by TimeoutProvider instead.
+func newHTTPClient(connectTimeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+
+	return &http.Client{Transport: transport}
+}
+
+// TimeoutProvider enforces the time-to-first-token, idle and total
+// deadlines of TimeoutConfig around another Provider.
+type TimeoutProvider struct {
+	provider Provider
+	config   TimeoutConfig
+}
+
+func NewTimeoutProvider(provider Provider, config TimeoutConfig) *TimeoutProvider {
+	return &TimeoutProvider{
+		provider: provider,
+		config:   config,
+	}
+}
+
+func (p *TimeoutProvider) Name() string {
+	return p.provider.Name()
+}
+
+func (p *TimeoutProvider) StreamCompletion(ctx context.Context, request models.ChatRequest, responseChan chan<- models.StreamChunk, errorChan chan<- error) {
+	defer close(responseChan)
+	defer close(errorChan)
+
+	streamCtx, cancel := p.withTotalTimeout(ctx)
+	defer cancel(nil)
+
+	attemptChan := make(chan models.StreamChunk, cap(responseChan))
+	attemptErrorChan := make(chan error, 1)
+	go p.provider.StreamCompletion(streamCtx, request, attemptChan, attemptErrorChan)
+
+	deadline := newDeadline(p.config.FirstToken, FirstTokenTimeout)
+	defer deadline.stop()
+
+	for {
+		select {
+		case chunk, ok := <-attemptChan:
+			if !ok {
+				if err := <-attemptErrorChan; err != nil {
+					errorChan <- p.timeoutCause(streamCtx, err)
+				}
+				return
+			}
+
+			// Retry announcements are not progress of the reply itself
+			if chunk.Retry == nil {
+				deadline.reset(p.config.Idle, IdleTimeout)
+			}
+
+			if !sendChunk(ctx, responseChan, chunk) {
+				errorChan <- ctx.Err()
+				return
+			}
+
+		case <-deadline.C():
+			timeoutErr := deadline.err()
+			cancel(timeoutErr)
+			errorChan <- timeoutErr
+			return
+		}
+	}
+}
+
+func (p *TimeoutProvider) Complete(ctx context.Context, request models.ChatRequest) (*models.ChatResponse, error) {
+	completeCtx, cancel := p.withTotalTimeout(ctx)
+	defer cancel(nil)
+
+	response, err := p.provider.Complete(completeCtx, request)
+	if err != nil {
+		return nil, p.timeoutCause(completeCtx, err)
+	}
+	return response, nil
+}
+
+func (p *TimeoutProvider) ValidateAPIKey() error {
+	return p.provider.ValidateAPIKey()
+}
+
+// withTotalTimeout derives a context that is cancelled with a TimeoutError
+// once the total deadline passes, and that the caller can cancel with a
+// cause of its own.
+func (p *TimeoutProvider) withTotalTimeout(ctx context.Context) (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	if p.config.Total > 0 {
+		timer := time.AfterFunc(p.config.Total, func() {
+			cancel(&TimeoutError{Code: TotalTimeout, Timeout: p.config.Total})
+		})
+		return ctx, func(cause error) {
+			timer.Stop()
+			cancel(cause)
+		}
+	}
+	return ctx, cancel
+}
+
+// timeoutCause replaces the error of a call aborted by one of our deadlines
+// with the TimeoutError naming it
+func (p *TimeoutProvider) timeoutCause(ctx context.Context, err error) error {
+	var timeoutErr *TimeoutError
+	if errors.As(context.Cause(ctx), &timeoutErr) {
+		return timeoutErr
+	}
+	return err
+}
+
+// deadline is a resettable timer that remembers which timeout it stands
+// for. A zero duration disarms it.
+type deadline struct {
+	timer   *time.Timer
+	code    string
+	timeout time.Duration
+}
+
+func newDeadline(timeout time.Duration, code string) *deadline {
+	d := &deadline{}
+	d.reset(timeout, code)
+	return d
+}
+
+func (d *deadline) reset(timeout time.Duration, code string) {
+	d.stop()
+	d.code = code
+	d.timeout = timeout
+	if timeout > 0 {
+		d.timer = time.NewTimer(timeout)
+	}
+}
+
+func (d *deadline) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+}
+
+// C returns the timer channel, or nil (which blocks forever) when disarmed
+func (d *deadline) C() <-chan time.Time {
+	if d.timer == nil {
+		return nil
+	}
+	return d.timer.C
+}
+
+func (d *deadline) err() *TimeoutError {
+	return &TimeoutError{Code: d.code, Timeout: d.timeout}
+}
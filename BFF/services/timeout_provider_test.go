@@ -0,0 +1,78 @@
+package services
+
+import (
+	"bff/models"
+	"context"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutProvider(t *testing.T) {
+	request := models.ChatRequest{Messages: []models.Message{{Role: "user", Content: "Hi"}}}
+	longReply := strings.Repeat("word ", 20)
+
+	t.Run("should not cut off a slow but steady stream", func(t *testing.T) {
+		fake := &FakeProvider{Reply: longReply, ChunkDelay: 5 * time.Millisecond}
+		provider := NewTimeoutProvider(fake, TimeoutConfig{FirstToken: time.Second, Idle: time.Second})
+
+		content, _, err := collectStream(provider, request)
+
+		require.NoError(t, err)
+		assert.Equal(t, longReply, content)
+	})
+
+	t.Run("should report each deadline with its own code", func(t *testing.T) {
+		cases := []struct {
+			code   string
+			fake   *FakeProvider
+			config TimeoutConfig
+		}{
+			{FirstTokenTimeout, &FakeProvider{Reply: longReply, ChunkDelay: 200 * time.Millisecond}, TimeoutConfig{FirstToken: 20 * time.Millisecond}},
+			{IdleTimeout, &FakeProvider{Reply: longReply, ChunkDelay: 50 * time.Millisecond}, TimeoutConfig{FirstToken: time.Second, Idle: 20 * time.Millisecond}},
+			{TotalTimeout, &FakeProvider{Reply: longReply, ChunkDelay: 10 * time.Millisecond}, TimeoutConfig{Total: 50 * time.Millisecond}},
+		}
+
+		for _, tc := range cases {
+			_, _, err := collectStream(NewTimeoutProvider(tc.fake, tc.config), request)
+
+			var timeoutErr *TimeoutError
+			require.ErrorAs(t, err, &timeoutErr, tc.code)
+			assert.Equal(t, tc.code, timeoutErr.Code)
+		}
+	})
+
+	t.Run("should apply the total deadline to non-streaming calls", func(t *testing.T) {
+		provider := NewTimeoutProvider(&slowCompleteProvider{}, TimeoutConfig{Total: 20 * time.Millisecond})
+
+		_, err := provider.Complete(context.Background(), request)
+
+		var timeoutErr *TimeoutError
+		require.ErrorAs(t, err, &timeoutErr)
+		assert.Equal(t, TotalTimeout, timeoutErr.Code)
+	})
+}
+
+func TestConnectTimeoutError(t *testing.T) {
+	err := newConnectionError(&net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded})
+
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, ConnectTimeout, timeoutErr.Code)
+	assert.True(t, err.Retryable)
+}
+
+// slowCompleteProvider blocks Complete until its context ends
+type slowCompleteProvider struct {
+	FakeProvider
+}
+
+func (p *slowCompleteProvider) Complete(ctx context.Context, request models.ChatRequest) (*models.ChatResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
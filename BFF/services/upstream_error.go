@@ -0,0 +1,87 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// UpstreamError is returned by providers when the call to the backend fails,
+// carrying what the retry logic needs to decide whether to try again.
+type UpstreamError struct {
+	// StatusCode is 0 when no HTTP response was received
+	StatusCode int
+	Message    string
+	// RetryAfter is the wait the backend asked for, if any
+	RetryAfter time.Duration
+	Retryable  bool
+	Err        error
+}
+
+func (e *UpstreamError) Error() string {
+	return e.Message
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// newStatusError consumes the body of a non-200 response. Rate limits and
+// server errors are worth retrying; other client errors are not.
+func newStatusError(vendor string, resp *http.Response) *UpstreamError {
+	body, _ := io.ReadAll(resp.Body)
+	return &UpstreamError{
+		StatusCode: resp.StatusCode,
+		Message:    fmt.Sprintf("%s API error: %d - %s", vendor, resp.StatusCode, string(body)),
+		RetryAfter: retryAfterFromHeaders(resp.Header, time.Now()),
+		Retryable:  resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError,
+	}
+}
+
+// newConnectionError wraps a failed request. A dial that ran into the
+// connect deadline is reported as a TimeoutError so it gets its own code.
+func newConnectionError(err error) *UpstreamError {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout() {
+		err = fmt.Errorf("%w: %w", &TimeoutError{Code: ConnectTimeout}, err)
+	}
+
+	return &UpstreamError{
+		Message:   fmt.Sprintf("failed to make request: %v", err),
+		Retryable: true,
+		Err:       err,
+	}
+}
+
+// retryAfterFromHeaders reads the wait requested through retry-after-ms,
+// Retry-After (seconds or HTTP date), or, when a rate limit is exhausted,
+// the matching x-ratelimit-reset-* header.
+func retryAfterFromHeaders(header http.Header, now time.Time) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		if date, err := http.ParseTime(value); err == nil && date.After(now) {
+			return date.Sub(now)
+		}
+	}
+
+	var wait time.Duration
+	for _, limit := range []string{"requests", "tokens"} {
+		if header.Get("x-ratelimit-remaining-"+limit) != "0" {
+			continue
+		}
+		if reset, err := time.ParseDuration(header.Get("x-ratelimit-reset-" + limit)); err == nil && reset > wait {
+			wait = reset
+		}
+	}
+	return wait
+}
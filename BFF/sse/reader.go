@@ -0,0 +1,188 @@
+// Package sse reads Server-Sent Events streams as specified in the HTML
+// Living Standard (https://html.spec.whatwg.org/multipage/server-sent-events.html).
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// DefaultMaxEventSize bounds the data of a single event, so a misbehaving
+// upstream cannot make the reader buffer without limit.
+const DefaultMaxEventSize = 16 << 20
+
+// ErrEventTooLarge is returned when a line or the data of an event exceeds
+// the reader's maximum event size.
+var ErrEventTooLarge = errors.New("sse: event too large")
+
+// Event is a single dispatched event.
+type Event struct {
+	// ID is the last event ID seen on the stream, which carries over to
+	// later events that do not set one
+	ID string
+	// Type is the event field, "message" when the event has none
+	Type string
+	// Data holds the data lines joined by "\n"
+	Data string
+	// Retry is the last reconnection time the server asked for, 0 if unset
+	Retry time.Duration
+}
+
+// DecodeError is returned when the data of an event is not the JSON the
+// caller expected.
+type DecodeError struct {
+	Type string
+	Data string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("sse: failed to decode %q event: %v", e.Type, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Decode unmarshals the event data as JSON into v.
+func (e *Event) Decode(v any) error {
+	if err := json.Unmarshal([]byte(e.Data), v); err != nil {
+		return &DecodeError{Type: e.Type, Data: e.Data, Err: err}
+	}
+	return nil
+}
+
+// Reader parses events from an event stream. Lines may end in CRLF, LF or
+// a lone CR, and lines starting with a colon are comments.
+type Reader struct {
+	scanner      *bufio.Scanner
+	maxEventSize int
+	lastID       string
+	retry        time.Duration
+	started      bool
+}
+
+// NewReader returns a Reader with DefaultMaxEventSize.
+func NewReader(r io.Reader) *Reader {
+	return NewReaderSize(r, DefaultMaxEventSize)
+}
+
+// NewReaderSize returns a Reader that fails with ErrEventTooLarge on
+// events whose data exceeds maxEventSize bytes.
+func NewReaderSize(r io.Reader, maxEventSize int) *Reader {
+	scanner := bufio.NewScanner(r)
+	// Leave room for the field name of a line holding a maximum-sized event
+	maxLineSize := maxEventSize + len("data: ") + 1
+	scanner.Buffer(make([]byte, 0, min(4096, maxLineSize)), maxLineSize)
+	scanner.Split(scanLines)
+
+	return &Reader{scanner: scanner, maxEventSize: maxEventSize}
+}
+
+// Next returns the next event, or io.EOF once the stream ended. As the
+// spec requires, an event that is not terminated by a blank line before
+// the end of the stream is discarded.
+func (r *Reader) Next() (*Event, error) {
+	var data bytes.Buffer
+	var eventType string
+	hasData := false
+
+	for r.scanner.Scan() {
+		line := r.scanner.Bytes()
+		if !r.started {
+			line = bytes.TrimPrefix(line, []byte("\xEF\xBB\xBF"))
+			r.started = true
+		}
+
+		// A blank line dispatches the event, unless no data was given
+		if len(line) == 0 {
+			if !hasData {
+				eventType = ""
+				continue
+			}
+			if eventType == "" {
+				eventType = "message"
+			}
+			return &Event{ID: r.lastID, Type: eventType, Data: data.String(), Retry: r.retry}, nil
+		}
+
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value, _ := bytes.Cut(line, []byte(":"))
+		value = bytes.TrimPrefix(value, []byte(" "))
+
+		switch string(field) {
+		case "event":
+			eventType = string(value)
+
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			if data.Len()+len(value) > r.maxEventSize {
+				return nil, ErrEventTooLarge
+			}
+			data.Write(value)
+			hasData = true
+
+		case "id":
+			// IDs containing NUL are ignored
+			if !bytes.ContainsRune(value, 0) {
+				r.lastID = string(value)
+			}
+
+		case "retry":
+			// Only plain digits are valid, which ParseUint already enforces
+			if ms, err := strconv.ParseUint(string(value), 10, 32); err == nil {
+				r.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, ErrEventTooLarge
+		}
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// LastEventID returns the most recent event ID seen on the stream.
+func (r *Reader) LastEventID() string {
+	return r.lastID
+}
+
+// scanLines is a bufio.SplitFunc that splits on CRLF, LF or CR.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// A CR at the end of the buffer may be the first half of a CRLF
+		if i+1 == len(data) && !atEOF {
+			return 0, nil, nil
+		}
+		if i+1 < len(data) && data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
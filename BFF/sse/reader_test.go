@@ -0,0 +1,86 @@
+package sse
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAll collects every event of the stream until it ends.
+func readAll(t *testing.T, reader *Reader) []Event {
+	var events []Event
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return events
+		}
+		require.NoError(t, err)
+		events = append(events, *event)
+	}
+}
+
+func TestReader(t *testing.T) {
+	t.Run("should parse event, id, retry and data fields", func(t *testing.T) {
+		stream := ": keep-alive\n\nevent: delta\nid: 7\nretry: 1500\ndata: {\"a\":1}\n\ndata:no space\n\n"
+
+		events := readAll(t, NewReader(strings.NewReader(stream)))
+
+		assert.Equal(t, []Event{
+			{ID: "7", Type: "delta", Data: `{"a":1}`, Retry: 1500 * time.Millisecond},
+			{ID: "7", Type: "message", Data: "no space", Retry: 1500 * time.Millisecond},
+		}, events)
+	})
+
+	t.Run("should join multi-line data and accept any line ending", func(t *testing.T) {
+		stream := "\xEF\xBB\xBFdata: first\r\ndata\r\ndata: third\r\n\r\ndata: cr\r\rdata: lf\n\n"
+
+		events := readAll(t, NewReader(strings.NewReader(stream)))
+
+		require.Len(t, events, 3)
+		assert.Equal(t, "first\n\nthird", events[0].Data)
+		assert.Equal(t, "cr", events[1].Data)
+		assert.Equal(t, "lf", events[2].Data)
+	})
+
+	t.Run("should skip events without data and drop an unterminated last event", func(t *testing.T) {
+		stream := "event: ping\n\nid: 3\n\ndata: kept\n\ndata: lost"
+
+		reader := NewReader(strings.NewReader(stream))
+		events := readAll(t, reader)
+
+		assert.Equal(t, []Event{{ID: "3", Type: "message", Data: "kept"}}, events)
+		assert.Equal(t, "3", reader.LastEventID())
+	})
+
+	t.Run("should read payloads beyond the default scanner limit", func(t *testing.T) {
+		large := strings.Repeat("x", 1<<20)
+
+		events := readAll(t, NewReader(strings.NewReader("data: "+large+"\n\n")))
+
+		require.Len(t, events, 1)
+		assert.Equal(t, large, events[0].Data)
+	})
+
+	t.Run("should fail on events over the size limit", func(t *testing.T) {
+		_, err := NewReaderSize(strings.NewReader("data: "+strings.Repeat("x", 100)+"\n\n"), 10).Next()
+		assert.ErrorIs(t, err, ErrEventTooLarge)
+
+		_, err = NewReaderSize(strings.NewReader("data: 123456\ndata: 123456\n\n"), 10).Next()
+		assert.ErrorIs(t, err, ErrEventTooLarge)
+	})
+
+	t.Run("should return a DecodeError for invalid JSON", func(t *testing.T) {
+		event := Event{Type: "message", Data: "{not json"}
+
+		var target struct{}
+		err := event.Decode(&target)
+
+		var decodeErr *DecodeError
+		require.ErrorAs(t, err, &decodeErr)
+		assert.Equal(t, "{not json", decodeErr.Data)
+	})
+}
@@ -0,0 +1,56 @@
+package sse
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteEvent encodes an event onto w. Data spanning several lines is sent
+// as one data field per line, so the Reader gets it back unchanged. Empty
+// ID and Type fields, and a zero Retry, are left out.
+func WriteEvent(w io.Writer, event Event) error {
+	var buf bytes.Buffer
+
+	if event.ID != "" {
+		if strings.ContainsAny(event.ID, "\r\n\x00") {
+			return fmt.Errorf("sse: invalid event id %q", event.ID)
+		}
+		buf.WriteString("id: " + event.ID + "\n")
+	}
+	if event.Type != "" {
+		if strings.ContainsAny(event.Type, "\r\n") {
+			return fmt.Errorf("sse: invalid event type %q", event.Type)
+		}
+		buf.WriteString("event: " + event.Type + "\n")
+	}
+	if event.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	data := strings.ReplaceAll(strings.ReplaceAll(event.Data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteString("\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteComment encodes a comment onto w, one line per line of text.
+// Readers ignore comments, which makes them suitable as keep-alives.
+func WriteComment(w io.Writer, comment string) error {
+	var buf bytes.Buffer
+
+	comment = strings.ReplaceAll(strings.ReplaceAll(comment, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(comment, "\n") {
+		buf.WriteString(": " + line + "\n")
+	}
+	buf.WriteString("\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
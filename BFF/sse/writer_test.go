@@ -0,0 +1,48 @@
+package sse
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteEvent(t *testing.T) {
+	t.Run("should round-trip through the Reader", func(t *testing.T) {
+		var buf strings.Builder
+		event := Event{ID: "12", Type: "delta", Data: "line one\nline two\r\nline three", Retry: 2 * time.Second}
+
+		require.NoError(t, WriteEvent(&buf, event))
+		assert.Equal(t, "id: 12\nevent: delta\nretry: 2000\ndata: line one\ndata: line two\ndata: line three\n\n", buf.String())
+
+		events := readAll(t, NewReader(strings.NewReader(buf.String())))
+		require.Len(t, events, 1)
+		assert.Equal(t, "line one\nline two\nline three", events[0].Data)
+		assert.Equal(t, "12", events[0].ID)
+	})
+
+	t.Run("should reject ids and types that would break the framing", func(t *testing.T) {
+		var buf strings.Builder
+
+		assert.Error(t, WriteEvent(&buf, Event{ID: "1\n2", Data: "x"}))
+		assert.Error(t, WriteEvent(&buf, Event{Type: "a\nb", Data: "x"}))
+		assert.Empty(t, buf.String())
+	})
+}
+
+func TestWriteComment(t *testing.T) {
+	t.Run("should write lines the Reader skips", func(t *testing.T) {
+		var buf strings.Builder
+
+		require.NoError(t, WriteComment(&buf, "keep-alive"))
+		require.NoError(t, WriteComment(&buf, "two\nlines"))
+		require.NoError(t, WriteEvent(&buf, Event{Data: "after"}))
+		assert.Equal(t, ": keep-alive\n\n: two\n: lines\n\ndata: after\n\n", buf.String())
+
+		events := readAll(t, NewReader(strings.NewReader(buf.String())))
+		require.Len(t, events, 1)
+		assert.Equal(t, "after", events[0].Data)
+	})
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetEnv returns the value of the environment variable, or fallback if it is unset or empty
+func GetEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// GetEnvBool parses the environment variable as a boolean, returning fallback if it is unset or invalid
+func GetEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetEnvList splits a comma-separated environment variable, dropping empty entries
+func GetEnvList(key string) []string {
+	return SplitList(os.Getenv(key))
+}
+
+// SplitList splits a comma-separated list, dropping empty entries
+func SplitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// GetEnvInt parses the environment variable as an integer, returning fallback if it is unset or invalid
+func GetEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetEnvDuration parses the environment variable as a duration such as "500ms", returning fallback if it is unset or invalid
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
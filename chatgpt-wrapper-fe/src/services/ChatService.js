@@ -1,5 +1,5 @@
 export const ChatService = {
-  async sendMessage(message, userId) {
+  async sendMessage(message, userId, conversationId) {
     try {
       const response = await fetch("http://localhost:8081/messages", {
         method: "POST",
@@ -9,6 +9,7 @@ export const ChatService = {
         body: JSON.stringify({
           message: message,
           userId: userId,
+          conversationId: conversationId,
         }),
       });
 
@@ -56,7 +57,7 @@ export const ChatService = {
   createSSEConnection(userId, messageId) {
     const url = `http://localhost:8081/ask-chatgpt?userId=${encodeURIComponent(
       userId
-    )}&messageId=${encodeURIComponent(messageId)}`;
+    )}&messageId=${encodeURIComponent(messageId)}&format=text`;
     return new EventSource(url);
   },
 };